@@ -1,15 +1,44 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+
 	"github.com/EmilyShepherd/kios-aws/pkg/awsbootstrap"
+	"github.com/EmilyShepherd/kios-aws/pkg/csrapprover"
+	"github.com/EmilyShepherd/kios-aws/pkg/nodemetadata"
 	"github.com/EmilyShepherd/kios-go-sdk/pkg/bootstrap"
 )
 
 var Bootstrap = bootstrap.Bootstrap{
-	Binaries: []string{"aws-iam-authenticator", "ecr-credential-provider"},
+	Binaries: []string{"aws-bootstrap", "ecr-credential-provider"},
 	Provider: &awsbootstrap.Provider{},
 }
 
+// Additional commands which can be run instead of the bootstrap, by
+// passing their name as the first argument, or by running aws-bootstrap
+// under their name
+var Commands = map[string]func(){
+	"apply-node-metadata":     nodemetadata.Run,
+	"token":                   awsbootstrap.RunToken,
+	"ecr-credential-provider": awsbootstrap.RunECRCredentialProvider,
+	"csr-approver":            csrapprover.Run,
+}
+
 func main() {
+	// The kubelet runs credential providers by name, so the ECR provider
+	// is a copy of aws-bootstrap. Commands always see their own arguments
+	// from os.Args[2], however they were run.
+	if name := filepath.Base(os.Args[0]); Commands[name] != nil {
+		os.Args = append([]string{os.Args[0], name}, os.Args[1:]...)
+	}
+
+	if len(os.Args) > 1 {
+		if command, ok := Commands[os.Args[1]]; ok {
+			command()
+			return
+		}
+	}
+
 	Bootstrap.Run()
 }
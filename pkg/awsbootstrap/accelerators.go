@@ -0,0 +1,417 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/EmilyShepherd/kios-go-sdk/pkg/socket"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// Where sysfs is mounted. This is a variable so that detection can be
+// pointed at a fixture tree.
+var SysfsPath = "/sys"
+
+// CRI-O reads drop-in configuration from this directory, in addition to
+// the crio.conf written by the bootstrap SDK
+var CrioDropInPath = "/etc/crio/crio.conf.d/20-accelerator.conf"
+
+// Manufacturers, as used in Karpenter's labels
+const (
+	ManufacturerNVIDIA = "nvidia"
+	ManufacturerAMD    = "amd"
+	ManufacturerAWS    = "aws"
+	ManufacturerHabana = "habana"
+)
+
+// Labels describing the node's accelerators. GPUs and other
+// accelerators (Inferentia, Trainium and Gaudi) get different labels,
+// in the same way as Karpenter does.
+const (
+	LabelGPUName         = "karpenter.k8s.aws/instance-gpu-name"
+	LabelGPUManufacturer = "karpenter.k8s.aws/instance-gpu-manufacturer"
+	LabelGPUCount        = "karpenter.k8s.aws/instance-gpu-count"
+	LabelGPUMemory       = "karpenter.k8s.aws/instance-gpu-memory"
+
+	LabelAcceleratorName         = "karpenter.k8s.aws/instance-accelerator-name"
+	LabelAcceleratorManufacturer = "karpenter.k8s.aws/instance-accelerator-manufacturer"
+	LabelAcceleratorCount        = "karpenter.k8s.aws/instance-accelerator-count"
+)
+
+// Device plugins are normally scheduled onto nodes with these labels
+var presentLabels = map[string]string{
+	ManufacturerNVIDIA: "nvidia.com/gpu.present",
+	ManufacturerAMD:    "amd.com/gpu.present",
+	ManufacturerAWS:    "aws.amazon.com/neuron.present",
+	ManufacturerHabana: "habana.ai/gaudi.present",
+}
+
+// The extended resource each manufacturer's device plugin advertises,
+// which is also used as the key of the accelerator taint
+var acceleratorResources = map[string]string{
+	ManufacturerNVIDIA: "nvidia.com/gpu",
+	ManufacturerAMD:    "amd.com/gpu",
+	ManufacturerAWS:    "aws.amazon.com/neuron",
+	ManufacturerHabana: "habana.ai/gaudi",
+}
+
+// The runtimes containers need to use the accelerator, where the
+// default OCI runtime is not enough
+var defaultRuntimeHandlers = map[string]RuntimeHandler{
+	ManufacturerNVIDIA: {
+		Name: "nvidia",
+		Path: "/usr/bin/nvidia-container-runtime",
+	},
+}
+
+// A CRI-O runtime handler
+type RuntimeHandler struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// The accelerators attached to an instance
+type Accelerator struct {
+	Manufacturer string
+	Name         string
+	Count        int
+
+	// Memory per device, in MiB
+	Memory int
+
+	// False for accelerators which are not GPUs, eg Inferentia
+	GPU bool
+}
+
+// The accelerators used by each instance family
+var acceleratorFamilies = map[string]Accelerator{
+	"p2":    {ManufacturerNVIDIA, "k80", 0, 12288, true},
+	"p3":    {ManufacturerNVIDIA, "v100", 0, 16384, true},
+	"p3dn":  {ManufacturerNVIDIA, "v100", 0, 32768, true},
+	"p4d":   {ManufacturerNVIDIA, "a100", 0, 40960, true},
+	"p4de":  {ManufacturerNVIDIA, "a100", 0, 81920, true},
+	"p5":    {ManufacturerNVIDIA, "h100", 0, 81920, true},
+	"p5e":   {ManufacturerNVIDIA, "h200", 0, 144384, true},
+	"p5en":  {ManufacturerNVIDIA, "h200", 0, 144384, true},
+	"g3":    {ManufacturerNVIDIA, "m60", 0, 8192, true},
+	"g3s":   {ManufacturerNVIDIA, "m60", 0, 8192, true},
+	"g4dn":  {ManufacturerNVIDIA, "t4", 0, 16384, true},
+	"g4ad":  {ManufacturerAMD, "radeon-pro-v520", 0, 8192, true},
+	"g5":    {ManufacturerNVIDIA, "a10g", 0, 24576, true},
+	"g5g":   {ManufacturerNVIDIA, "t4g", 0, 16384, true},
+	"g6":    {ManufacturerNVIDIA, "l4", 0, 24576, true},
+	"g6e":   {ManufacturerNVIDIA, "l40s", 0, 49152, true},
+	"inf1":  {ManufacturerAWS, "inferentia", 0, 8192, false},
+	"inf2":  {ManufacturerAWS, "inferentia", 0, 32768, false},
+	"trn1":  {ManufacturerAWS, "trainium", 0, 32768, false},
+	"trn1n": {ManufacturerAWS, "trainium", 0, 32768, false},
+	"trn2":  {ManufacturerAWS, "trainium", 0, 98304, false},
+	"dl1":   {ManufacturerHabana, "gaudi-hl-205", 0, 32768, false},
+}
+
+// The number of accelerators on each accelerated instance type
+var acceleratorCounts = map[string]int{
+	"p2.xlarge":      1,
+	"p2.8xlarge":     8,
+	"p2.16xlarge":    16,
+	"p3.2xlarge":     1,
+	"p3.8xlarge":     4,
+	"p3.16xlarge":    8,
+	"p3dn.24xlarge":  8,
+	"p4d.24xlarge":   8,
+	"p4de.24xlarge":  8,
+	"p5.48xlarge":    8,
+	"p5e.48xlarge":   8,
+	"p5en.48xlarge":  8,
+	"g3s.xlarge":     1,
+	"g3.4xlarge":     1,
+	"g3.8xlarge":     2,
+	"g3.16xlarge":    4,
+	"g4dn.xlarge":    1,
+	"g4dn.2xlarge":   1,
+	"g4dn.4xlarge":   1,
+	"g4dn.8xlarge":   1,
+	"g4dn.16xlarge":  1,
+	"g4dn.12xlarge":  4,
+	"g4dn.metal":     8,
+	"g4ad.xlarge":    1,
+	"g4ad.2xlarge":   1,
+	"g4ad.4xlarge":   1,
+	"g4ad.8xlarge":   2,
+	"g4ad.16xlarge":  4,
+	"g5.xlarge":      1,
+	"g5.2xlarge":     1,
+	"g5.4xlarge":     1,
+	"g5.8xlarge":     1,
+	"g5.16xlarge":    1,
+	"g5.12xlarge":    4,
+	"g5.24xlarge":    4,
+	"g5.48xlarge":    8,
+	"g5g.xlarge":     1,
+	"g5g.2xlarge":    1,
+	"g5g.4xlarge":    1,
+	"g5g.8xlarge":    1,
+	"g5g.16xlarge":   2,
+	"g5g.metal":      2,
+	"g6.xlarge":      1,
+	"g6.2xlarge":     1,
+	"g6.4xlarge":     1,
+	"g6.8xlarge":     1,
+	"g6.16xlarge":    1,
+	"g6.12xlarge":    4,
+	"g6.24xlarge":    4,
+	"g6.48xlarge":    8,
+	"g6e.xlarge":     1,
+	"g6e.2xlarge":    1,
+	"g6e.4xlarge":    1,
+	"g6e.8xlarge":    1,
+	"g6e.16xlarge":   1,
+	"g6e.12xlarge":   4,
+	"g6e.24xlarge":   4,
+	"g6e.48xlarge":   8,
+	"inf1.xlarge":    1,
+	"inf1.2xlarge":   1,
+	"inf1.6xlarge":   4,
+	"inf1.24xlarge":  16,
+	"inf2.xlarge":    1,
+	"inf2.8xlarge":   1,
+	"inf2.24xlarge":  6,
+	"inf2.48xlarge":  12,
+	"trn1.2xlarge":   1,
+	"trn1.32xlarge":  16,
+	"trn1n.32xlarge": 16,
+	"trn2.48xlarge":  16,
+	"dl1.24xlarge":   8,
+}
+
+// PCI vendor IDs of accelerator manufacturers
+var pciVendors = map[string]string{
+	"0x10de": ManufacturerNVIDIA,
+	"0x1002": ManufacturerAMD,
+	"0x1d0f": ManufacturerAWS,
+	"0x1da3": ManufacturerHabana,
+}
+
+// Amazon's vendor ID is also used for ENA and EBS devices, so Neuron
+// devices are picked out by their device ID
+var neuronDevices = map[string]bool{
+	"0x7064": true,
+	"0x7164": true,
+	"0x7264": true,
+	"0x7364": true,
+}
+
+// Returns the catalog's entry for the given instance type
+func catalogAccelerator(instanceType string) (Accelerator, bool) {
+	family, _ := splitInstanceType(instanceType)
+	accelerator, ok := acceleratorFamilies[family]
+	if !ok {
+		return Accelerator{}, false
+	}
+
+	accelerator.Count = acceleratorCounts[instanceType]
+
+	return accelerator, true
+}
+
+func readSysfsValue(path string) string {
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(value))
+}
+
+// Counts the accelerators on the PCI bus under the given sysfs root, by
+// manufacturer. GPUs are told apart from other NVIDIA and AMD devices
+// (eg NVSwitches) by their display controller class.
+func detectPCIAccelerators(sysfs string) (map[string]int, error) {
+	devices, err := os.ReadDir(filepath.Join(sysfs, "bus/pci/devices"))
+	if err != nil {
+		return nil, fmt.Errorf("Could not list PCI devices: %s", err)
+	}
+
+	counts := make(map[string]int)
+	for _, device := range devices {
+		base := filepath.Join(sysfs, "bus/pci/devices", device.Name())
+		manufacturer, ok := pciVendors[readSysfsValue(filepath.Join(base, "vendor"))]
+		if !ok {
+			continue
+		}
+
+		switch manufacturer {
+		case ManufacturerNVIDIA, ManufacturerAMD:
+			if !strings.HasPrefix(readSysfsValue(filepath.Join(base, "class")), "0x03") {
+				continue
+			}
+		case ManufacturerAWS:
+			if !neuronDevices[readSysfsValue(filepath.Join(base, "device"))] {
+				continue
+			}
+		}
+
+		counts[manufacturer]++
+	}
+
+	return counts, nil
+}
+
+// Works out the instance's accelerators. The PCI bus is the source of
+// truth for the manufacturer and count where it can be read, with the
+// catalog filling in the details the bus cannot tell us.
+func (p *Provider) accelerator() (Accelerator, bool) {
+	if p.accelerators != nil {
+		return *p.accelerators, p.accelerators.Count != 0
+	}
+
+	instanceType, _ := p.imds.GetString("meta-data/instance-type")
+	accelerator, inCatalog := catalogAccelerator(instanceType)
+
+	counts, err := detectPCIAccelerators(SysfsPath)
+	if err != nil {
+		klog.Warningf("Could not detect accelerators from PCI devices, relying on the catalog: %s", err)
+	} else {
+		for manufacturer, count := range counts {
+			if inCatalog && manufacturer != accelerator.Manufacturer {
+				klog.Warningf("Found %d unexpected %s devices on %s. Ignoring", count, manufacturer, instanceType)
+				continue
+			}
+
+			if !inCatalog {
+				klog.Warningf("Instance type %s is not in the accelerator catalog. Found %d %s devices", instanceType, count, manufacturer)
+				accelerator = Accelerator{
+					Manufacturer: manufacturer,
+					GPU:          manufacturer == ManufacturerNVIDIA || manufacturer == ManufacturerAMD,
+				}
+				inCatalog = true
+			} else if accelerator.Count != count {
+				klog.Warningf("Expected %d accelerators on %s, but found %d", accelerator.Count, instanceType, count)
+			}
+
+			accelerator.Count = count
+		}
+	}
+
+	if !inCatalog {
+		accelerator = Accelerator{}
+	} else if accelerator.Count != 0 {
+		klog.Infof("Found %d %s %s accelerators", accelerator.Count, accelerator.Manufacturer, accelerator.Name)
+	}
+
+	p.accelerators = &accelerator
+
+	return accelerator, accelerator.Count != 0
+}
+
+// Adds the labels describing the node's accelerators, if it has any
+func (p *Provider) acceleratorLabels(labels map[string]string) {
+	accelerator, ok := p.accelerator()
+	if !ok {
+		return
+	}
+
+	count := strconv.Itoa(accelerator.Count)
+	if accelerator.GPU {
+		setLabel(labels, LabelGPUName, accelerator.Name)
+		setLabel(labels, LabelGPUManufacturer, accelerator.Manufacturer)
+		setLabel(labels, LabelGPUCount, count)
+		if accelerator.Memory != 0 {
+			setLabel(labels, LabelGPUMemory, strconv.Itoa(accelerator.Memory))
+		}
+	} else {
+		setLabel(labels, LabelAcceleratorName, accelerator.Name)
+		setLabel(labels, LabelAcceleratorManufacturer, accelerator.Manufacturer)
+		setLabel(labels, LabelAcceleratorCount, count)
+	}
+
+	setLabel(labels, presentLabels[accelerator.Manufacturer], "true")
+}
+
+// Returns a NoSchedule taint for the node's accelerators, if it has any
+// and this is enabled, so that only pods which need them land on it
+func (p *Provider) acceleratorTaints() []v1.Taint {
+	if !p.config.Node.Accelerators.Taint {
+		return nil
+	}
+
+	accelerator, ok := p.accelerator()
+	if !ok {
+		return nil
+	}
+
+	return []v1.Taint{{
+		Key:    acceleratorResources[accelerator.Manufacturer],
+		Effect: v1.TaintEffectNoSchedule,
+	}}
+}
+
+// Returns the runtime handler that containers should use to access the
+// node's accelerators, if one is needed
+func (p *Provider) runtimeHandler() (RuntimeHandler, bool) {
+	if !p.config.Node.Accelerators.ConfigureRuntime {
+		return RuntimeHandler{}, false
+	}
+
+	accelerator, ok := p.accelerator()
+	if !ok {
+		return RuntimeHandler{}, false
+	}
+
+	handler, ok := defaultRuntimeHandlers[accelerator.Manufacturer]
+	if override := p.config.Node.Accelerators.RuntimeHandler; override != nil {
+		handler, ok = *override, true
+	}
+
+	return handler, ok && handler.Name != "" && handler.Path != ""
+}
+
+// Writes a CRI-O drop-in adding the accelerator's runtime handler. The
+// drop-in is always rewritten (or removed) so that a handler from a
+// previous boot does not linger. Returns true if the handler was added.
+func (p *Provider) saveRuntimeHandler() bool {
+	handler, ok := p.runtimeHandler()
+	if !ok {
+		if err := os.Remove(CrioDropInPath); err != nil && !os.IsNotExist(err) {
+			klog.Errorf("Could not remove %s: %s", CrioDropInPath, err)
+		}
+		return false
+	}
+
+	var config strings.Builder
+	if p.config.Node.Accelerators.DefaultRuntime {
+		fmt.Fprintf(&config, "[crio.runtime]\ndefault_runtime = %q\n\n", handler.Name)
+	}
+	fmt.Fprintf(&config, "[crio.runtime.runtimes.%s]\nruntime_path = %q\nruntime_type = \"oci\"\n", handler.Name, handler.Path)
+
+	if err := os.MkdirAll(filepath.Dir(CrioDropInPath), 0755); err != nil {
+		klog.Errorf("Could not create %s: %s", filepath.Dir(CrioDropInPath), err)
+		return false
+	}
+	if err := os.WriteFile(CrioDropInPath, []byte(config.String()), 0644); err != nil {
+		klog.Errorf("Could not write runtime handler: %s", err)
+		return false
+	}
+
+	klog.Infof("Added runtime handler %s (%s)", handler.Name, handler.Path)
+
+	return true
+}
+
+// Asks kiOS to restart CRI-O, so that it picks up the runtime handler
+func restartCrio() {
+	systemSocket, err := socket.NewSystemSocket()
+	if err != nil {
+		klog.Errorf("Could not open a connection to the system socket to restart CRI-O: %s", err)
+		return
+	}
+
+	klog.Warning("Runtime handler added. Crio will be restarted")
+	if err := systemSocket.SendCmd(socket.CmdRestartCrio); err != nil {
+		klog.Errorf("Could not restart CRI-O: %s", err)
+	}
+}
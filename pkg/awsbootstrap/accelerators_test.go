@@ -0,0 +1,153 @@
+package awsbootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The sysfs fixtures under testdata/sysfs have the vendor, device and
+// class files of each PCI device. Their directory names use dashes
+// rather than colons, which are not allowed in module file names.
+func TestAccelerator(t *testing.T) {
+	nvidiaHandler := "[crio.runtime.runtimes.nvidia]\n" +
+		"runtime_path = \"/usr/bin/nvidia-container-runtime\"\n" +
+		"runtime_type = \"oci\"\n"
+
+	tests := []struct {
+		name         string
+		sysfs        string
+		instanceType string
+		options      AcceleratorOptions
+		want         Accelerator
+		wantDropIn   string
+	}{
+		{
+			name:         "nvidia",
+			sysfs:        "nvidia",
+			instanceType: "g5.12xlarge",
+			options:      AcceleratorOptions{ConfigureRuntime: true},
+			want:         Accelerator{ManufacturerNVIDIA, "a10g", 4, 24576, true},
+			wantDropIn:   nvidiaHandler,
+		},
+		{
+			name:         "nvidia default runtime",
+			sysfs:        "nvidia",
+			instanceType: "g5.12xlarge",
+			options:      AcceleratorOptions{ConfigureRuntime: true, DefaultRuntime: true},
+			want:         Accelerator{ManufacturerNVIDIA, "a10g", 4, 24576, true},
+			wantDropIn:   "[crio.runtime]\ndefault_runtime = \"nvidia\"\n\n" + nvidiaHandler,
+		},
+		{
+			name:         "nvidia without runtime configuration",
+			sysfs:        "nvidia",
+			instanceType: "g5.12xlarge",
+			want:         Accelerator{ManufacturerNVIDIA, "a10g", 4, 24576, true},
+		},
+		{
+			name:         "nvidia not in the catalog",
+			sysfs:        "nvidia",
+			instanceType: "g99.12xlarge",
+			options:      AcceleratorOptions{ConfigureRuntime: true},
+			want:         Accelerator{Manufacturer: ManufacturerNVIDIA, Count: 4, GPU: true},
+			wantDropIn:   nvidiaHandler,
+		},
+		{
+			name:         "neuron",
+			sysfs:        "neuron",
+			instanceType: "inf2.24xlarge",
+			options:      AcceleratorOptions{ConfigureRuntime: true},
+			want:         Accelerator{ManufacturerAWS, "inferentia", 6, 32768, false},
+		},
+		{
+			name:         "neuron with a runtime handler",
+			sysfs:        "neuron",
+			instanceType: "inf2.24xlarge",
+			options: AcceleratorOptions{
+				ConfigureRuntime: true,
+				RuntimeHandler:   &RuntimeHandler{Name: "neuron", Path: "/usr/bin/neuron-runtime"},
+			},
+			want: Accelerator{ManufacturerAWS, "inferentia", 6, 32768, false},
+			wantDropIn: "[crio.runtime.runtimes.neuron]\n" +
+				"runtime_path = \"/usr/bin/neuron-runtime\"\n" +
+				"runtime_type = \"oci\"\n",
+		},
+		{
+			name:         "no accelerators",
+			sysfs:        "empty",
+			instanceType: "m5.large",
+			options:      AcceleratorOptions{ConfigureRuntime: true},
+		},
+		{
+			name:         "catalog only",
+			sysfs:        "empty",
+			instanceType: "g5.xlarge",
+			options:      AcceleratorOptions{ConfigureRuntime: true},
+			want:         Accelerator{ManufacturerNVIDIA, "a10g", 1, 24576, true},
+			wantDropIn:   nvidiaHandler,
+		},
+		{
+			name:         "no sysfs",
+			sysfs:        "missing",
+			instanceType: "inf2.xlarge",
+			want:         Accelerator{ManufacturerAWS, "inferentia", 1, 32768, false},
+		},
+	}
+
+	defer func(sysfs, dropIn string) {
+		SysfsPath, CrioDropInPath = sysfs, dropIn
+	}(SysfsPath, CrioDropInPath)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SysfsPath = filepath.Join("testdata/sysfs", test.sysfs)
+			CrioDropInPath = filepath.Join(t.TempDir(), "crio.conf.d/20-accelerator.conf")
+
+			// A handler left over from a previous boot
+			os.MkdirAll(filepath.Dir(CrioDropInPath), 0755)
+			os.WriteFile(CrioDropInPath, []byte("stale"), 0644)
+
+			p := &Provider{
+				imds:   fakeImds(t, map[string]string{"meta-data/instance-type": test.instanceType}),
+				config: &MetadataInformation{Node: Node{Accelerators: test.options}},
+			}
+
+			got, ok := p.accelerator()
+			if got != test.want || ok != (test.want.Count != 0) {
+				t.Errorf("accelerator() = %+v, %t, want %+v", got, ok, test.want)
+			}
+
+			if saved := p.saveRuntimeHandler(); saved != (test.wantDropIn != "") {
+				t.Errorf("saveRuntimeHandler() = %t", saved)
+			}
+
+			dropIn, err := os.ReadFile(CrioDropInPath)
+			if test.wantDropIn == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("Drop-in was not removed: %q", dropIn)
+				}
+			} else if string(dropIn) != test.wantDropIn {
+				t.Errorf("Drop-in = %q, want %q", dropIn, test.wantDropIn)
+			}
+		})
+	}
+}
+
+func TestDetectPCIAccelerators(t *testing.T) {
+	for sysfs, want := range map[string]map[string]int{
+		"nvidia": {ManufacturerNVIDIA: 4},
+		"neuron": {ManufacturerAWS: 6},
+		"empty":  {},
+	} {
+		counts, err := detectPCIAccelerators(filepath.Join("testdata/sysfs", sysfs))
+		if err != nil || len(counts) != len(want) {
+			t.Errorf("detectPCIAccelerators(%s) = %v, %v, want %v", sysfs, counts, err, want)
+			continue
+		}
+		for manufacturer, count := range want {
+			if counts[manufacturer] != count {
+				t.Errorf("detectPCIAccelerators(%s) = %v, want %v", sysfs, counts, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package awsbootstrap
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// The version of kios-aws, set at build time
+var Version = "dev"
+
+// Annotations which are always added to the node
+const (
+	AnnotationInstanceID = "kios.redcoat.dev/instance-id"
+	AnnotationAMIID      = "kios.redcoat.dev/ami-id"
+	AnnotationVersion    = "kios.redcoat.dev/version"
+)
+
+// The node's signed instance identity document, which the CSR approver
+// can use to check the node really is the instance it claims to be
+const (
+	AnnotationIdentityDocument  = "kios.redcoat.dev/identity-document"
+	AnnotationIdentitySignature = "kios.redcoat.dev/identity-signature"
+)
+
+// The API server rejects objects whose annotations add up to more than
+// this
+const maxAnnotationsSize = 256 * 1024
+
+// Returns the annotations to apply to the node: the computed ones, plus
+// those from the user data (which take precedence). Annotations are
+// checked with the same rules as the API server uses, and dropped with
+// an error if they would be rejected.
+func (p *Provider) nodeAnnotations() map[string]string {
+	annotations := make(map[string]string)
+
+	instanceID, _ := p.imds.GetString("meta-data/instance-id")
+	amiID, _ := p.imds.GetString("meta-data/ami-id")
+	setAnnotation(annotations, AnnotationInstanceID, instanceID)
+	setAnnotation(annotations, AnnotationAMIID, amiID)
+	setAnnotation(annotations, AnnotationVersion, Version)
+
+	if p.labelSetEnabled(LabelSetNetwork) {
+		p.networkAnnotations(annotations)
+	}
+
+	if p.config.Node.AttachIdentityDocument {
+		document, _ := p.imds.GetString("dynamic/instance-identity/document")
+		signature, _ := p.imds.GetString("dynamic/instance-identity/signature")
+		setAnnotation(annotations, AnnotationIdentityDocument, document)
+		setAnnotation(annotations, AnnotationIdentitySignature, strings.ReplaceAll(signature, "\n", ""))
+	}
+
+	size := 0
+	for key, value := range p.config.Node.Annotations {
+		size += len(key) + len(value)
+	}
+	if size > maxAnnotationsSize {
+		klog.Errorf("Annotations in user data total %d bytes, more than the %d allowed. Ignoring them", size, maxAnnotationsSize)
+		return annotations
+	}
+
+	for key, value := range p.config.Node.Annotations {
+		if errs := validation.IsQualifiedName(strings.ToLower(key)); len(errs) != 0 {
+			klog.Errorf("Dropping annotation with invalid key %s: %s", key, strings.Join(errs, ", "))
+			continue
+		}
+
+		annotations[key] = value
+	}
+
+	return annotations
+}
+
+func setAnnotation(annotations map[string]string, key, value string) {
+	if value != "" {
+		annotations[key] = value
+	}
+}
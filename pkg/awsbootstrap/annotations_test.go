@@ -0,0 +1,45 @@
+package awsbootstrap
+
+import (
+	"testing"
+)
+
+func TestIdentityDocumentAnnotations(t *testing.T) {
+	imds := map[string]string{
+		"dynamic/instance-identity/document":  `{"instanceId": "i-0123456789abcdef0"}`,
+		"dynamic/instance-identity/signature": "c2lnbmF0\ndXJl\n",
+	}
+
+	tests := []struct {
+		name   string
+		attach bool
+	}{
+		{name: "attached", attach: true},
+		{name: "not attached"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Provider{
+				imds:   fakeImds(t, imds),
+				config: &MetadataInformation{Node: Node{AttachIdentityDocument: test.attach}},
+			}
+			annotations := p.nodeAnnotations()
+
+			document, signature := annotations[AnnotationIdentityDocument], annotations[AnnotationIdentitySignature]
+			if !test.attach {
+				if document != "" || signature != "" {
+					t.Errorf("Identity document was attached: %v", annotations)
+				}
+				return
+			}
+
+			if document != imds["dynamic/instance-identity/document"] {
+				t.Errorf("Identity document = %q", document)
+			}
+			if signature != "c2lnbmF0dXJl" {
+				t.Errorf("Identity signature = %q, want it without newlines", signature)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Session names are shown in CloudTrail and can be mapped in aws-auth
+// with {{SessionName}}, so by default we use the instance ID
+const DefaultSessionName = "{{InstanceID}}"
+
+// The characters STS allows in a session name
+var sessionNameRegexp = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+var roleARNRegexp = regexp.MustCompile(`^arn:([a-z-]+):iam::(\d{12}):role/.+$`)
+
+// Checks that a role can be assumed from the given region. Roles in
+// other partitions are unreachable, as each partition has its own IAM.
+func validateRoleARN(roleARN string, resolver *Resolver) error {
+	match := roleARNRegexp.FindStringSubmatch(roleARN)
+	if match == nil {
+		return fmt.Errorf("%s is not a valid IAM role ARN", roleARN)
+	}
+
+	if partition := resolver.Partition.ID; match[1] != partition {
+		return fmt.Errorf("Role %s is in the %s partition, but %s is in %s", roleARN, match[1], resolver.Region, partition)
+	}
+
+	return nil
+}
+
+// Expands the placeholders in a session name template. The same
+// placeholders as aws-auth uses for nodes are supported.
+func (p *Provider) sessionName() (string, error) {
+	template := p.config.ApiServer.SessionName
+	if template == "" {
+		template = DefaultSessionName
+	}
+
+	name := template
+	if strings.Contains(name, "{{InstanceID}}") {
+		instanceID, err := p.imds.GetString("meta-data/instance-id")
+		if err != nil {
+			return "", fmt.Errorf("Could not determine instance ID: %s", err)
+		}
+		name = strings.ReplaceAll(name, "{{InstanceID}}", instanceID)
+	}
+	if strings.Contains(name, "{{EC2PrivateDNSName}}") {
+		privateDNSName, err := p.privateDNSName()
+		if err != nil {
+			return "", err
+		}
+		name = strings.ReplaceAll(name, "{{EC2PrivateDNSName}}", privateDNSName)
+	}
+
+	if !sessionNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("Session name %s (from %s) is not a valid STS session name", name, template)
+	}
+
+	return name, nil
+}
+
+// Returns the arguments for the token command which configure how the
+// node authenticates: the role to assume (if any) and the STS endpoint
+func (p *Provider) authArgs() ([]string, error) {
+	var args []string
+	apiServer := p.config.ApiServer
+
+	if p.resolver().FIPS {
+		args = append(args, "--fips")
+	}
+
+	if apiServer.STSEndpoint != "" {
+		u, err := url.Parse(apiServer.STSEndpoint)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("stsEndpoint %s must be an https URL", apiServer.STSEndpoint)
+		}
+
+		args = append(args, "--sts-endpoint", apiServer.STSEndpoint)
+	}
+
+	if apiServer.RoleARN == "" {
+		if apiServer.ExternalID != "" {
+			return nil, fmt.Errorf("externalID is set, but there is no roleARN to assume")
+		}
+
+		return args, nil
+	}
+
+	if err := validateRoleARN(apiServer.RoleARN, p.resolver()); err != nil {
+		return nil, err
+	}
+
+	sessionName, err := p.sessionName()
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, "--role-arn", apiServer.RoleARN, "--session-name", sessionName)
+	if apiServer.ExternalID != "" {
+		args = append(args, "--external-id", apiServer.ExternalID)
+	}
+
+	return args, nil
+}
@@ -0,0 +1,355 @@
+package awsbootstrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A very small AWS API client. kiOS only needs to make a handful of
+// AWS API calls during bootstrap, so we sign these ourselves rather
+// than pulling in the whole AWS SDK.
+type AwsClient struct {
+	Region      string
+	Resolver    *Resolver
+	Credentials *Credentials
+	HTTPClient  *http.Client
+
+	// Endpoints to use instead of the regional defaults, keyed by service
+	Endpoints map[string]string
+
+	// If set, loads new credentials whenever there are none or they are
+	// about to expire. Long running commands need this, as temporary
+	// credentials only last a few hours.
+	Refresh func() (*Credentials, error)
+
+	lock sync.Mutex
+}
+
+// Creates a new AwsClient using the instance profile credentials. As
+// with the AWS SDKs, credentials in the environment take precedence, in
+// which case imds may be nil.
+func NewAwsClient(imds *ImdsSession, resolver *Resolver) (*AwsClient, error) {
+	creds, ok := EnvCredentials()
+	if !ok {
+		if imds == nil {
+			return nil, fmt.Errorf("No credentials in the environment, and IMDS is not available")
+		}
+
+		var err error
+		if creds, err = imds.GetCredentials(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &AwsClient{
+		Region:      resolver.Region,
+		Resolver:    resolver,
+		Credentials: creds,
+		HTTPClient:  http.DefaultClient,
+	}, nil
+}
+
+// Returns the regional endpoint for the given service
+func (c *AwsClient) endpoint(service string) string {
+	if endpoint, ok := c.Endpoints[service]; ok {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+
+	return c.Resolver.Endpoint(service)
+}
+
+// Returns the credentials to sign requests with, refreshing them first
+// if they are about to expire
+func (c *AwsClient) credentials() (*Credentials, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.Refresh != nil && (c.Credentials == nil || c.Credentials.expiresWithin(credentialRefreshMargin)) {
+		creds, err := c.Refresh()
+		if err != nil {
+			return nil, fmt.Errorf("Could not refresh credentials: %s", err)
+		}
+		c.Credentials = creds
+	}
+
+	if c.Credentials == nil {
+		return nil, fmt.Errorf("No credentials are available")
+	}
+
+	return c.Credentials, nil
+}
+
+// Signs and sends the given request, returning the response body if
+// the request was successful
+func (c *AwsClient) do(req *http.Request, body []byte, service string) ([]byte, error) {
+	creds, err := c.credentials()
+	if err != nil {
+		return nil, err
+	}
+	creds.Sign(req, body, service, c.Region, time.Now())
+
+	return c.send(req, service)
+}
+
+// Sends the given request, returning the response body if the request
+// was successful
+func (c *AwsClient) send(req *http.Request, service string) ([]byte, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not complete %s request: %s", service, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s response: %s", service, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s request failed with %s: %s", service, resp.Status, raw)
+	}
+
+	return raw, nil
+}
+
+// Makes a call to an AWS JSON protocol API (eg SSM), marshalling the
+// input and unmarshalling the response into output
+func (c *AwsClient) callJSON(service, target string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("Could not marshal %s request: %s", target, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint(service)+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Could not create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	raw, err := c.do(req, body, service)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(raw, output); err != nil {
+		return fmt.Errorf("Could not parse %s response: %s", target, err)
+	}
+
+	return nil
+}
+
+// Makes a call to an AWS Query protocol API (eg EC2), unmarshalling the
+// XML response into output
+func (c *AwsClient) callQuery(service, action, version string, params url.Values, output interface{}) error {
+	query := url.Values{"Action": {action}, "Version": {version}}
+	for key, values := range params {
+		query[key] = values
+	}
+	body := []byte(canonicalQuery(query))
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint(service)+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Could not create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	raw, err := c.do(req, body, service)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(raw, output); err != nil {
+		return fmt.Errorf("Could not parse %s response: %s", action, err)
+	}
+
+	return nil
+}
+
+// Downloads an object from S3
+func (c *AwsClient) GetS3Object(bucket, key string) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s/%s", c.endpoint("s3"), bucket, strings.TrimPrefix(key, "/"))
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create request: %s", err)
+	}
+
+	return c.do(req, nil, "s3")
+}
+
+// Loads the value of an SSM parameter, decrypting it if it is a
+// SecureString
+func (c *AwsClient) GetSSMParameter(name string) (string, error) {
+	var output struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+
+	err := c.callJSON("ssm", "AmazonSSM.GetParameter", map[string]interface{}{
+		"Name":           name,
+		"WithDecryption": true,
+	}, &output)
+
+	return output.Parameter.Value, err
+}
+
+// Loads the value of a Secrets Manager secret. Only string secrets are
+// supported.
+func (c *AwsClient) GetSecretValue(secretID string) (string, error) {
+	var output struct {
+		SecretString string `json:"SecretString"`
+	}
+
+	err := c.callJSON("secretsmanager", "secretsmanager.GetSecretValue", map[string]interface{}{
+		"SecretId": secretID,
+	}, &output)
+	if err == nil && output.SecretString == "" {
+		err = fmt.Errorf("Secret %s has no string value", secretID)
+	}
+
+	return output.SecretString, err
+}
+
+// Assumes the given role, returning its temporary credentials
+func (c *AwsClient) AssumeRole(roleARN, sessionName, externalID string) (*Credentials, error) {
+	query := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {roleARN},
+		"RoleSessionName": {sessionName},
+	}
+	if externalID != "" {
+		query.Set("ExternalId", externalID)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.endpoint("sts")+"/?"+canonicalQuery(query), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create request: %s", err)
+	}
+
+	raw, err := c.do(req, nil, "sts")
+	if err != nil {
+		return nil, err
+	}
+
+	var output struct {
+		Credentials stsCredentials `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := xml.Unmarshal(raw, &output); err != nil {
+		return nil, fmt.Errorf("Could not parse AssumeRole response: %s", err)
+	}
+
+	return output.Credentials.credentials(), nil
+}
+
+// Assumes the given role with an OIDC token, as used by IAM Roles for
+// Service Accounts. The token is the credential, so the request is not
+// signed.
+func (c *AwsClient) AssumeRoleWithWebIdentity(roleARN, sessionName, token string) (*Credentials, error) {
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {token},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.endpoint("sts")+"/?"+canonicalQuery(query), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create request: %s", err)
+	}
+
+	raw, err := c.send(req, "sts")
+	if err != nil {
+		return nil, err
+	}
+
+	var output struct {
+		Credentials stsCredentials `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(raw, &output); err != nil {
+		return nil, fmt.Errorf("Could not parse AssumeRoleWithWebIdentity response: %s", err)
+	}
+
+	return output.Credentials.credentials(), nil
+}
+
+// Temporary credentials, as returned by STS
+type stsCredentials struct {
+	AccessKeyId     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	SessionToken    string    `xml:"SessionToken"`
+	Expiration      time.Time `xml:"Expiration"`
+}
+
+func (s stsCredentials) credentials() *Credentials {
+	return &Credentials{
+		AccessKeyId:     s.AccessKeyId,
+		SecretAccessKey: s.SecretAccessKey,
+		Token:           s.SessionToken,
+		Expiration:      s.Expiration,
+	}
+}
+
+// The details of an EC2 instance that identify it on the network
+type EC2Instance struct {
+	InstanceId     string
+	PrivateDNSName string
+	PublicDNSName  string
+	IPs            []string
+}
+
+// Describes a single EC2 instance
+func (c *AwsClient) DescribeInstance(instanceID string) (*EC2Instance, error) {
+	type address struct {
+		PrivateIP string `xml:"privateIpAddress"`
+		PublicIP  string `xml:"association>publicIp"`
+	}
+	var output struct {
+		Instances []struct {
+			InstanceId     string `xml:"instanceId"`
+			PrivateDNSName string `xml:"privateDnsName"`
+			PublicDNSName  string `xml:"dnsName"`
+			Interfaces     []struct {
+				Addresses     []address `xml:"privateIpAddressesSet>item"`
+				IPv6Addresses []string  `xml:"ipv6AddressesSet>item>ipv6Address"`
+			} `xml:"networkInterfaceSet>item"`
+		} `xml:"reservationSet>item>instancesSet>item"`
+	}
+
+	err := c.callQuery("ec2", "DescribeInstances", "2016-11-15", url.Values{"InstanceId.1": {instanceID}}, &output)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.Instances) != 1 {
+		return nil, fmt.Errorf("Expected 1 instance with ID %s, found %d", instanceID, len(output.Instances))
+	}
+
+	instance := output.Instances[0]
+	result := EC2Instance{
+		InstanceId:     instance.InstanceId,
+		PrivateDNSName: instance.PrivateDNSName,
+		PublicDNSName:  instance.PublicDNSName,
+	}
+	for _, iface := range instance.Interfaces {
+		for _, addr := range iface.Addresses {
+			result.IPs = append(result.IPs, addr.PrivateIP)
+			if addr.PublicIP != "" {
+				result.IPs = append(result.IPs, addr.PublicIP)
+			}
+		}
+		result.IPs = append(result.IPs, iface.IPv6Addresses...)
+	}
+
+	return &result, nil
+}
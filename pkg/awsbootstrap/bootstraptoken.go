@@ -0,0 +1,198 @@
+package awsbootstrap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	kubeconfig "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/certificate"
+	"k8s.io/client-go/util/certificate/csr"
+	"k8s.io/client-go/util/keyutil"
+	"k8s.io/klog/v2"
+)
+
+// The ways in which the node can authenticate with the API server
+const (
+	// An EKS token, generated from the node's IAM role. This is the
+	// default.
+	AuthModeIAMAuthenticator = "iam-authenticator"
+
+	// A bootstrap token, which the kubelet uses to request a client
+	// certificate (TLS bootstrapping), as with kubeadm clusters
+	AuthModeBootstrapToken = "bootstrap-token"
+)
+
+// kiOS does not pass the kubelet a --bootstrap-kubeconfig, so we do its
+// TLS bootstrapping for it: the client certificate is requested here
+// with the bootstrap token, and saved where the kubelet keeps its client
+// certificates, with the current one linked from
+// kubelet-client-current.pem. The kubelet renews it from then on.
+const (
+	KubeletPKIPath        = "/var/lib/kubelet/pki"
+	KubeletClientCertPath = KubeletPKIPath + "/kubelet-client-current.pem"
+)
+
+// How long to wait for the cluster to issue the client certificate
+var bootstrapCertificateTimeout = 5 * time.Minute
+
+// The format of bootstrap tokens: a token ID and a secret
+var bootstrapTokenRegexp = regexp.MustCompile(`^[a-z0-9]{6}\.[a-z0-9]{16}$`)
+
+// Returns the configured authentication mode
+func (p *Provider) authMode() string {
+	if p.config.ApiServer.Auth == "" {
+		return AuthModeIAMAuthenticator
+	}
+
+	return p.config.ApiServer.Auth
+}
+
+// Loads the bootstrap token, either from the user data itself, or from
+// a reference (see Provider.LoadReference)
+func (p *Provider) bootstrapToken() (string, error) {
+	token := p.config.ApiServer.BootstrapToken
+	if ref := p.config.ApiServer.BootstrapTokenFrom; ref != "" {
+		if token != "" {
+			return "", fmt.Errorf("Only one of bootstrapToken and bootstrapTokenFrom can be set")
+		}
+
+		value, err := p.LoadReference(ref)
+		if err != nil {
+			return "", fmt.Errorf("Could not load bootstrap token from %s: %s", ref, err)
+		}
+		token = strings.TrimSpace(string(value))
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("No bootstrap token was given")
+	} else if !bootstrapTokenRegexp.MatchString(token) {
+		return "", fmt.Errorf("The bootstrap token is not in the [a-z0-9]{6}.[a-z0-9]{16} format")
+	}
+
+	return token, nil
+}
+
+// Returns a client which authenticates with the bootstrap token
+func (p *Provider) bootstrapClient() (kubernetes.Interface, error) {
+	token, err := p.bootstrapToken()
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := p.clusterCA()
+	if err != nil {
+		return nil, fmt.Errorf("Could not load cluster CA: %s", err)
+	}
+
+	return kubernetes.NewForConfig(&rest.Config{
+		Host:            p.GetClusterEndpoint(),
+		BearerToken:     token,
+		TLSClientConfig: rest.TLSClientConfig{CAData: ca},
+	})
+}
+
+// Requests a client certificate for the given node, in the same way as
+// the kubelet does when it is given a bootstrap kubeconfig, and saves it
+// in the store once it has been issued
+func requestClientCertificate(client kubernetes.Interface, nodeName string, store certificate.Store) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("Could not generate private key: %s", err)
+	}
+	keyPEM, err := keyutil.MarshalPrivateKeyToPEM(key)
+	if err != nil {
+		return fmt.Errorf("Could not marshal private key: %s", err)
+	}
+
+	csrPEM, err := cert.MakeCSR(key, &pkix.Name{
+		CommonName:   "system:node:" + nodeName,
+		Organization: []string{"system:nodes"},
+	}, nil, nil)
+	if err != nil {
+		return fmt.Errorf("Could not create CSR: %s", err)
+	}
+
+	name, uid, err := csr.RequestCertificate(
+		client,
+		csrPEM,
+		"",
+		certificatesv1.KubeAPIServerClientKubeletSignerName,
+		nil,
+		[]certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageClientAuth},
+		key,
+	)
+	if err != nil {
+		return fmt.Errorf("Could not create CSR: %s", err)
+	}
+	klog.Infof("Requested client certificate with CSR %s, waiting for it to be issued", name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), bootstrapCertificateTimeout)
+	defer cancel()
+
+	certPEM, err := csr.WaitForCertificate(ctx, client, name, uid)
+	if err != nil {
+		return fmt.Errorf("CSR %s was not issued: %s", name, err)
+	}
+
+	if _, err := store.Update(certPEM, keyPEM); err != nil {
+		return fmt.Errorf("Could not save client certificate: %s", err)
+	}
+
+	return nil
+}
+
+// Makes sure the kubelet has a client certificate, requesting one with
+// the bootstrap token if it does not have one or it has expired
+func (p *Provider) bootstrapClientCertificate() error {
+	if err := os.MkdirAll(KubeletPKIPath, 0755); err != nil {
+		return fmt.Errorf("Could not create %s: %s", KubeletPKIPath, err)
+	}
+
+	store, err := certificate.NewFileStore("kubelet-client", KubeletPKIPath, KubeletPKIPath, "", "")
+	if err != nil {
+		return fmt.Errorf("Could not open kubelet certificate store: %s", err)
+	}
+
+	if current, err := store.Current(); err == nil && time.Now().Before(current.Leaf.NotAfter) {
+		klog.Infof("Using existing client certificate, which expires at %s", current.Leaf.NotAfter)
+		return nil
+	}
+
+	nodeName, err := p.hostname()
+	if err != nil {
+		return fmt.Errorf("Could not determine the node name: %s", err)
+	}
+
+	client, err := p.bootstrapClient()
+	if err != nil {
+		return err
+	}
+
+	return requestClientCertificate(client, nodeName, store)
+}
+
+// Returns the kubelet's credentials in bootstrap token mode: the client
+// certificate requested with the bootstrap token, which the kubelet
+// keeps up to date itself
+func (p *Provider) bootstrapTokenAuthInfo() kubeconfig.AuthInfo {
+	if err := p.bootstrapClientCertificate(); err != nil {
+		fatalf("Could not set up TLS bootstrapping: %s", err)
+	}
+
+	return kubeconfig.AuthInfo{
+		ClientCertificate: KubeletClientCertPath,
+		ClientKey:         KubeletClientCertPath,
+	}
+}
@@ -0,0 +1,155 @@
+package awsbootstrap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/certificate"
+)
+
+func TestBootstrapToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		from    string
+		want    string
+		wantErr bool
+	}{
+		{name: "inline", token: "abcdef.0123456789abcdef", want: "abcdef.0123456789abcdef"},
+		{name: "reference", from: "ssm:token", want: "abcdef.0123456789abcdef"},
+		{name: "both", token: "abcdef.0123456789abcdef", from: "ssm:token", wantErr: true},
+		{name: "missing", wantErr: true},
+		{name: "bad format", token: "abcdef0123456789abcdef", wantErr: true},
+		{name: "upper case", token: "ABCDEF.0123456789abcdef", wantErr: true},
+	}
+
+	aws := fakeAws(t, fakeReferences(map[string]string{"ssm:token": "abcdef.0123456789abcdef\n"}))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Provider{aws: aws, config: &MetadataInformation{}}
+			p.config.ApiServer.BootstrapToken = test.token
+			p.config.ApiServer.BootstrapTokenFrom = test.from
+
+			got, err := p.bootstrapToken()
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("bootstrapToken() = %q, want an error", got)
+				}
+			} else if err != nil || got != test.want {
+				t.Errorf("bootstrapToken() = %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+// Returns a clientset which approves and signs every CSR as soon as it
+// is created
+func fakeSigningClient(t *testing.T) *fake.Clientset {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubernetes"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		csr := action.(k8stesting.CreateAction).GetObject().(*certificatesv1.CertificateSigningRequest)
+
+		block, _ := pem.Decode(csr.Spec.Request)
+		request, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      request.Subject,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, ca, request.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		csr.Status.Conditions = []certificatesv1.CertificateSigningRequestCondition{{
+			Type:   certificatesv1.CertificateApproved,
+			Status: v1.ConditionTrue,
+		}}
+		csr.Status.Certificate = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+		return false, nil, nil
+	})
+
+	return client
+}
+
+func TestRequestClientCertificate(t *testing.T) {
+	client := fakeSigningClient(t)
+
+	dir := t.TempDir()
+	store, err := certificate.NewFileStore("kubelet-client", dir, dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := requestClientCertificate(client, "node-1", store); err != nil {
+		t.Fatal(err)
+	}
+
+	csrs, _ := client.CertificatesV1().CertificateSigningRequests().List(context.Background(), metav1.ListOptions{})
+	if len(csrs.Items) != 1 {
+		t.Fatalf("Created %d CSRs, want 1", len(csrs.Items))
+	}
+	spec := csrs.Items[0].Spec
+	if spec.SignerName != certificatesv1.KubeAPIServerClientKubeletSignerName {
+		t.Errorf("CSR signer = %s", spec.SignerName)
+	}
+	if len(spec.Usages) != 2 || spec.Usages[0] != certificatesv1.UsageDigitalSignature || spec.Usages[1] != certificatesv1.UsageClientAuth {
+		t.Errorf("CSR usages = %v", spec.Usages)
+	}
+
+	// The kubelet loads the certificate from kubelet-client-current.pem
+	current, err := certificate.NewFileStore("kubelet-client", dir, dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := current.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.CurrentPath() != dir+"/kubelet-client-current.pem" {
+		t.Errorf("Current certificate is at %s", current.CurrentPath())
+	}
+	if subject := pair.Leaf.Subject; subject.CommonName != "system:node:node-1" || len(subject.Organization) != 1 || subject.Organization[0] != "system:nodes" {
+		t.Errorf("Certificate subject = %s", subject)
+	}
+}
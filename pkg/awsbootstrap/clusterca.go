@@ -0,0 +1,169 @@
+package awsbootstrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// We warn if a CA certificate expires sooner than this, as nodes will
+// stop trusting the API server when it does
+const caExpiryWarning = 30 * 24 * time.Hour
+
+// Parses a bundle of one or more PEM certificates. The bundle may also
+// be base64 encoded, as b64ClusterCA historically has been.
+func parseCABundle(data []byte) ([]*x509.Certificate, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+		if err != nil {
+			return nil, fmt.Errorf("CA is neither PEM nor base64 encoded PEM: %s", err)
+		}
+		data = bytes.TrimSpace(decoded)
+	}
+
+	var certs []*x509.Certificate
+	for len(data) > 0 {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("CA bundle has invalid PEM data after %d certificates", len(certs))
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("CA bundle contains a %s, which is not a certificate", block.Type)
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse certificate %d in CA bundle: %s", len(certs)+1, err)
+		}
+
+		certs = append(certs, cert)
+		data = bytes.TrimSpace(rest)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("CA bundle is empty")
+	}
+
+	return certs, nil
+}
+
+// Checks that an unexpired certificate can be used as a CA. Certificates
+// which are not valid yet are only warned about, as the clock may not
+// have been synced this early in boot.
+func validateCACertificate(cert *x509.Certificate, now time.Time) error {
+	subject := cert.Subject.String()
+
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		return fmt.Errorf("Certificate %s is not a CA", subject)
+	}
+
+	if now.Before(cert.NotBefore) {
+		klog.Warningf("Certificate %s is not valid until %s, is the clock right?", subject, cert.NotBefore.Format(time.RFC3339))
+	} else if cert.NotAfter.Sub(now) < caExpiryWarning {
+		klog.Warningf("Certificate %s expires soon, at %s", subject, cert.NotAfter.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Returns the certificates in the bundle which can be used as a CA now.
+// Bundles often keep the old CA for a while after it has been rotated,
+// so expired certificates are dropped with a warning, as long as there
+// is still a valid one.
+func usableCACertificates(certs []*x509.Certificate, now time.Time) ([]*x509.Certificate, error) {
+	var usable []*x509.Certificate
+	for _, cert := range certs {
+		if now.After(cert.NotAfter) {
+			klog.Warningf("Ignoring CA certificate %s, which expired at %s", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+			continue
+		}
+
+		if err := validateCACertificate(cert, now); err != nil {
+			return nil, err
+		}
+		usable = append(usable, cert)
+	}
+
+	if len(usable) == 0 {
+		return nil, fmt.Errorf("Every certificate in the CA bundle has expired")
+	}
+
+	return usable, nil
+}
+
+// Loads the raw cluster CA, either from the user data itself, or from a
+// reference (see Provider.LoadReference). If a SHA-256 hash is given,
+// referenced data must match it, so that a CA fetched at boot can be
+// pinned.
+func (p *Provider) loadClusterCA() ([]byte, error) {
+	apiServer := p.config.ApiServer
+	if apiServer.ClusterCAFrom == "" {
+		if apiServer.ClusterCASHA256 != "" {
+			return nil, fmt.Errorf("clusterCASHA256 is set, but there is no clusterCAFrom to check")
+		}
+		if apiServer.CA == "" {
+			return nil, fmt.Errorf("Neither b64ClusterCA nor clusterCAFrom is set")
+		}
+
+		return []byte(apiServer.CA), nil
+	}
+
+	if apiServer.CA != "" {
+		return nil, fmt.Errorf("Only one of b64ClusterCA and clusterCAFrom can be set")
+	}
+
+	data, err := p.LoadReference(apiServer.ClusterCAFrom)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load cluster CA from %s: %s", apiServer.ClusterCAFrom, err)
+	}
+
+	if pin := apiServer.ClusterCASHA256; pin != "" {
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, pin) {
+			return nil, fmt.Errorf("Cluster CA from %s has SHA-256 %s, expected %s", apiServer.ClusterCAFrom, actual, pin)
+		}
+	}
+
+	return data, nil
+}
+
+// Returns the cluster CA bundle, checked and re-encoded as PEM. This is
+// only loaded once, as it is also used to check the API server.
+func (p *Provider) clusterCA() ([]byte, error) {
+	if p.caBundle != nil {
+		return p.caBundle, nil
+	}
+
+	data, err := p.loadClusterCA()
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err := parseCABundle(data)
+	if err != nil {
+		return nil, err
+	}
+
+	certs, err = usableCACertificates(certs, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle []byte
+	for _, cert := range certs {
+		klog.Infof("Trusting cluster CA %s, valid until %s", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	p.caBundle = bundle
+
+	return bundle, nil
+}
@@ -0,0 +1,273 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/klog/v2"
+	kubelet "k8s.io/kubelet/config/v1beta1"
+)
+
+// The name of the ECR credential provider, which is aws-bootstrap
+// itself
+const ECRCredentialProvider = "ecr-credential-provider"
+
+// The credential provider API versions
+const (
+	CredentialProviderV1       = "credentialprovider.kubelet.k8s.io/v1"
+	CredentialProviderV1beta1  = "credentialprovider.kubelet.k8s.io/v1beta1"
+	CredentialProviderV1alpha1 = "credentialprovider.kubelet.k8s.io/v1alpha1"
+)
+
+// A credential provider API version, and the kubelet versions which
+// support it
+type credentialProviderAPIVersion struct {
+	APIVersion string
+	Since      *version.Version
+
+	// The kubelet version which deprecated it, if it has been
+	Deprecated *version.Version
+
+	// The kubelet version which removed it, if it has been
+	Removed *version.Version
+}
+
+// The credential provider API versions the kubelet understands, newest
+// first
+var credentialProviderAPIVersions = []credentialProviderAPIVersion{
+	{CredentialProviderV1, version.MustParseGeneric("1.26"), nil, nil},
+	{CredentialProviderV1beta1, version.MustParseGeneric("1.24"), version.MustParseGeneric("1.26"), nil},
+	{CredentialProviderV1alpha1, version.MustParseGeneric("1.20"), version.MustParseGeneric("1.24"), version.MustParseGeneric("1.26")},
+}
+
+// The API versions the ECR credential provider understands
+var ecrAPIVersions = []string{CredentialProviderV1, CredentialProviderV1beta1, CredentialProviderV1alpha1}
+
+// Returns whether the given kubelet version supports an API version,
+// and whether it is deprecated there. If the kubelet version is not
+// known, any API version is assumed to be supported.
+func kubeletSupports(kubeletVersion *version.Version, apiVersion string) (bool, bool) {
+	for _, candidate := range credentialProviderAPIVersions {
+		if candidate.APIVersion != apiVersion {
+			continue
+		}
+
+		if kubeletVersion == nil {
+			return true, false
+		}
+
+		supported := kubeletVersion.AtLeast(candidate.Since) &&
+			(candidate.Removed == nil || kubeletVersion.LessThan(candidate.Removed))
+		deprecated := candidate.Deprecated != nil && kubeletVersion.AtLeast(candidate.Deprecated)
+
+		return supported, deprecated
+	}
+
+	return false, false
+}
+
+// Picks the newest API version that both the kubelet and a provider
+// (which supports the given versions) understand. If the kubelet's
+// version is unknown, we assume it is recent and use the newest version
+// the provider supports, as no single version works with every kubelet.
+func (p *Provider) chooseAPIVersion(name string, providerVersions []string) string {
+	kubeletVersion := p.kubeletVersion()
+	if kubeletVersion == nil {
+		klog.Warningf("Kubelet version unknown, using the newest API version credential provider %s supports", name)
+	}
+
+	for _, candidate := range credentialProviderAPIVersions {
+		supported, deprecated := kubeletSupports(kubeletVersion, candidate.APIVersion)
+		if !supported {
+			continue
+		}
+
+		for _, providerVersion := range providerVersions {
+			if providerVersion == candidate.APIVersion {
+				if deprecated {
+					klog.Warningf("Credential provider %s only supports %s, which is deprecated in kubelet %s", name, candidate.APIVersion, kubeletVersion)
+				}
+
+				return candidate.APIVersion
+			}
+		}
+	}
+
+	klog.Errorf("Credential provider %s supports none of the API versions that kubelet %s does", name, kubeletVersion)
+
+	return ""
+}
+
+// Returns the default ECR credential provider for the node's partition
+func (p *Provider) ecrCredentialProvider() kubelet.CredentialProvider {
+	var env []kubelet.ExecEnvVar
+	if p.resolver().FIPS {
+		env = append(env, kubelet.ExecEnvVar{Name: "AWS_USE_FIPS_ENDPOINT", Value: "true"})
+	}
+
+	// The kubelet has to be told to use the provider for aliases, as
+	// they do not look like ECR registries
+	options := p.config.Node.ECR
+	matchImages := p.resolver().ECRPatterns()
+	for alias := range options.Aliases {
+		matchImages = append(matchImages, alias)
+	}
+	sort.Strings(matchImages[len(p.resolver().ECRPatterns()):])
+
+	return kubelet.CredentialProvider{
+		Name:        ECRCredentialProvider,
+		MatchImages: matchImages,
+		DefaultCacheDuration: &metav1.Duration{
+			Duration: 12 * time.Hour,
+		},
+		APIVersion: p.chooseAPIVersion(ECRCredentialProvider, ecrAPIVersions),
+		Args:       append([]string{"get-credentials"}, options.Args()...),
+		Env:        env,
+	}
+}
+
+// Merges a provider from the user data into a default one. Images and
+// environment variables are added to the default's, and any other
+// fields which are set replace the default's.
+func patchCredentialProvider(provider, patch kubelet.CredentialProvider) kubelet.CredentialProvider {
+	provider.MatchImages = append(append([]string{}, provider.MatchImages...), patch.MatchImages...)
+
+	env := append([]kubelet.ExecEnvVar{}, provider.Env...)
+	for _, patchVar := range patch.Env {
+		replaced := false
+		for i := range env {
+			if env[i].Name == patchVar.Name {
+				env[i].Value = patchVar.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			env = append(env, patchVar)
+		}
+	}
+	provider.Env = env
+
+	if patch.DefaultCacheDuration != nil {
+		provider.DefaultCacheDuration = patch.DefaultCacheDuration
+	}
+	if patch.APIVersion != "" {
+		provider.APIVersion = patch.APIVersion
+	}
+	if len(patch.Args) != 0 {
+		provider.Args = patch.Args
+	}
+
+	return provider
+}
+
+// Checks a matchImages pattern in the same way as the kubelet does:
+// it must parse as a URL without a scheme, and globs are only allowed
+// in the host name
+func validateMatchImage(image string) error {
+	if image == "" {
+		return fmt.Errorf("matchImages must not contain empty patterns")
+	}
+	if strings.Contains(image, "://") {
+		return fmt.Errorf("matchImages pattern %s must not have a scheme", image)
+	}
+
+	u, err := url.Parse("https://" + image)
+	if err != nil {
+		return fmt.Errorf("Invalid matchImages pattern %s: %s", image, err)
+	}
+
+	if strings.Contains(u.Port(), "*") || strings.Contains(u.Path, "*") {
+		return fmt.Errorf("matchImages pattern %s can only have globs in its host name", image)
+	}
+
+	return nil
+}
+
+// Returns the reasons, if any, that the given version of the kubelet
+// would reject the credential provider
+func credentialProviderProblems(provider kubelet.CredentialProvider, kubeletVersion *version.Version) []string {
+	var problems []string
+
+	if provider.Name == "" {
+		problems = append(problems, "name is required")
+	} else if strings.ContainsAny(provider.Name, `/\`) || provider.Name == "." || provider.Name == ".." {
+		problems = append(problems, "name must be the name of a file in the credential provider directory")
+	}
+
+	if len(provider.MatchImages) == 0 {
+		problems = append(problems, "at least one matchImages pattern is required")
+	}
+	for _, image := range provider.MatchImages {
+		if err := validateMatchImage(image); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if provider.DefaultCacheDuration == nil {
+		problems = append(problems, "defaultCacheDuration is required")
+	} else if provider.DefaultCacheDuration.Duration < 0 {
+		problems = append(problems, "defaultCacheDuration must not be negative")
+	}
+
+	if supported, deprecated := kubeletSupports(kubeletVersion, provider.APIVersion); !supported {
+		problems = append(problems, fmt.Sprintf("apiVersion %q is not supported by this kubelet", provider.APIVersion))
+	} else if deprecated {
+		klog.Warningf("Credential provider %s uses %s, which is deprecated in kubelet %s", provider.Name, provider.APIVersion, kubeletVersion)
+	}
+
+	for _, env := range provider.Env {
+		if env.Name == "" {
+			problems = append(problems, "env variables must have a name")
+		}
+	}
+
+	return problems
+}
+
+// Builds the list of credential providers from the defaults and the
+// user data. A single invalid provider would stop the kubelet from
+// starting, so invalid ones are dropped with an error.
+func (p *Provider) credentialProviders() []kubelet.CredentialProvider {
+	options := p.config.Node.CredentialProviders
+
+	var providers []kubelet.CredentialProvider
+	if !options.Replace {
+		providers = append(providers, p.ecrCredentialProvider())
+	}
+
+	for _, provider := range options.Providers {
+		patched := false
+		for i := range providers {
+			if providers[i].Name == provider.Name {
+				klog.Infof("Patching default credential provider %s", provider.Name)
+				providers[i] = patchCredentialProvider(providers[i], provider)
+				patched = true
+			}
+		}
+
+		if !patched {
+			providers = append(providers, provider)
+		}
+	}
+
+	var valid []kubelet.CredentialProvider
+	for _, provider := range providers {
+		if problems := credentialProviderProblems(provider, p.kubeletVersion()); len(problems) != 0 {
+			klog.Errorf("Dropping invalid credential provider %s: %s", provider.Name, strings.Join(problems, "; "))
+			continue
+		}
+
+		valid = append(valid, provider)
+	}
+
+	if len(valid) == 0 {
+		klog.Warning("No credential providers are configured, so private images can only be pulled with pull secrets")
+	}
+
+	return valid
+}
@@ -0,0 +1,216 @@
+package awsbootstrap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	kubelet "k8s.io/kubelet/config/v1beta1"
+)
+
+func TestPatchCredentialProvider(t *testing.T) {
+	provider := kubelet.CredentialProvider{
+		Name:                 ECRCredentialProvider,
+		MatchImages:          []string{"*.dkr.ecr.*.amazonaws.com"},
+		DefaultCacheDuration: &metav1.Duration{Duration: 12 * time.Hour},
+		APIVersion:           CredentialProviderV1,
+		Args:                 []string{"get-credentials"},
+		Env:                  []kubelet.ExecEnvVar{{Name: "AWS_USE_FIPS_ENDPOINT", Value: "true"}},
+	}
+
+	tests := []struct {
+		name  string
+		patch kubelet.CredentialProvider
+		want  kubelet.CredentialProvider
+	}{
+		{
+			name: "empty",
+			want: provider,
+		},
+		{
+			name: "images and env are added",
+			patch: kubelet.CredentialProvider{
+				MatchImages: []string{"ecr-cache.example.com"},
+				Env:         []kubelet.ExecEnvVar{{Name: "AWS_PROFILE", Value: "image-pull"}},
+			},
+			want: kubelet.CredentialProvider{
+				Name:                 ECRCredentialProvider,
+				MatchImages:          []string{"*.dkr.ecr.*.amazonaws.com", "ecr-cache.example.com"},
+				DefaultCacheDuration: &metav1.Duration{Duration: 12 * time.Hour},
+				APIVersion:           CredentialProviderV1,
+				Args:                 []string{"get-credentials"},
+				Env: []kubelet.ExecEnvVar{
+					{Name: "AWS_USE_FIPS_ENDPOINT", Value: "true"},
+					{Name: "AWS_PROFILE", Value: "image-pull"},
+				},
+			},
+		},
+		{
+			name:  "env replaces the default's value",
+			patch: kubelet.CredentialProvider{Env: []kubelet.ExecEnvVar{{Name: "AWS_USE_FIPS_ENDPOINT", Value: "false"}}},
+			want: kubelet.CredentialProvider{
+				Name:                 ECRCredentialProvider,
+				MatchImages:          []string{"*.dkr.ecr.*.amazonaws.com"},
+				DefaultCacheDuration: &metav1.Duration{Duration: 12 * time.Hour},
+				APIVersion:           CredentialProviderV1,
+				Args:                 []string{"get-credentials"},
+				Env:                  []kubelet.ExecEnvVar{{Name: "AWS_USE_FIPS_ENDPOINT", Value: "false"}},
+			},
+		},
+		{
+			name: "other fields replace the default's",
+			patch: kubelet.CredentialProvider{
+				DefaultCacheDuration: &metav1.Duration{Duration: time.Hour},
+				APIVersion:           CredentialProviderV1beta1,
+				Args:                 []string{"get-credentials", "--role-arn", "arn:aws:iam::111122223333:role/image-pull"},
+			},
+			want: kubelet.CredentialProvider{
+				Name:                 ECRCredentialProvider,
+				MatchImages:          []string{"*.dkr.ecr.*.amazonaws.com"},
+				DefaultCacheDuration: &metav1.Duration{Duration: time.Hour},
+				APIVersion:           CredentialProviderV1beta1,
+				Args:                 []string{"get-credentials", "--role-arn", "arn:aws:iam::111122223333:role/image-pull"},
+				Env:                  []kubelet.ExecEnvVar{{Name: "AWS_USE_FIPS_ENDPOINT", Value: "true"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := patchCredentialProvider(provider, test.patch)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("patchCredentialProvider() = %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+
+	// The default's slices must not be shared with the patched copy
+	if len(provider.MatchImages) != 1 || provider.Env[0].Value != "true" {
+		t.Errorf("patchCredentialProvider() modified the default: %+v", provider)
+	}
+}
+
+func TestCredentialProviders(t *testing.T) {
+	hour := &metav1.Duration{Duration: time.Hour}
+	custom := kubelet.CredentialProvider{
+		Name:                 "my-credential-provider",
+		MatchImages:          []string{"registry.example.com"},
+		DefaultCacheDuration: hour,
+		APIVersion:           CredentialProviderV1,
+	}
+
+	tests := []struct {
+		name    string
+		kubelet string
+		options CredentialProviderOptions
+		want    []string
+	}{
+		{
+			name: "default",
+			want: []string{ECRCredentialProvider},
+		},
+		{
+			name:    "extend",
+			options: CredentialProviderOptions{Providers: []kubelet.CredentialProvider{custom}},
+			want:    []string{ECRCredentialProvider, "my-credential-provider"},
+		},
+		{
+			name:    "replace",
+			options: CredentialProviderOptions{Replace: true, Providers: []kubelet.CredentialProvider{custom}},
+			want:    []string{"my-credential-provider"},
+		},
+		{
+			name:    "replace with nothing",
+			options: CredentialProviderOptions{Replace: true},
+		},
+		{
+			name: "patch",
+			options: CredentialProviderOptions{Providers: []kubelet.CredentialProvider{{
+				Name:        ECRCredentialProvider,
+				MatchImages: []string{"ecr-cache.example.com"},
+			}}},
+			want: []string{ECRCredentialProvider},
+		},
+		{
+			name: "invalid patch drops the default",
+			options: CredentialProviderOptions{Providers: []kubelet.CredentialProvider{{
+				Name:        ECRCredentialProvider,
+				MatchImages: []string{"https://ecr-cache.example.com"},
+			}}},
+		},
+		{
+			name: "invalid providers are dropped",
+			options: CredentialProviderOptions{Providers: []kubelet.CredentialProvider{
+				{Name: "no-images", DefaultCacheDuration: hour, APIVersion: CredentialProviderV1},
+				{Name: "no-cache-duration", MatchImages: []string{"registry.example.com"}, APIVersion: CredentialProviderV1},
+				{Name: "../escape", MatchImages: []string{"registry.example.com"}, DefaultCacheDuration: hour, APIVersion: CredentialProviderV1},
+				{Name: "glob-path", MatchImages: []string{"registry.example.com/*"}, DefaultCacheDuration: hour, APIVersion: CredentialProviderV1},
+				{Name: "unnamed-env", MatchImages: []string{"registry.example.com"}, DefaultCacheDuration: hour, APIVersion: CredentialProviderV1, Env: []kubelet.ExecEnvVar{{Value: "x"}}},
+				custom,
+			}},
+			want: []string{ECRCredentialProvider, "my-credential-provider"},
+		},
+		{
+			name:    "API version the kubelet does not support",
+			kubelet: "1.25.0",
+			options: CredentialProviderOptions{Providers: []kubelet.CredentialProvider{custom}},
+			want:    []string{ECRCredentialProvider},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kubeletVersion := test.kubelet
+			if kubeletVersion == "" {
+				kubeletVersion = "1.27.1"
+			}
+
+			p := &Provider{
+				config:     &MetadataInformation{Node: Node{CredentialProviders: test.options}},
+				endpoints:  testResolver,
+				kubeletVer: version.MustParseGeneric(kubeletVersion),
+			}
+
+			var names []string
+			for _, provider := range p.credentialProviders() {
+				names = append(names, provider.Name)
+			}
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("credentialProviders() = %v, want %v", names, test.want)
+			}
+		})
+	}
+}
+
+func TestCredentialProvidersPatch(t *testing.T) {
+	p := &Provider{
+		config: &MetadataInformation{Node: Node{CredentialProviders: CredentialProviderOptions{
+			Providers: []kubelet.CredentialProvider{{
+				Name:        ECRCredentialProvider,
+				MatchImages: []string{"ecr-cache.example.com"},
+				Env:         []kubelet.ExecEnvVar{{Name: "AWS_PROFILE", Value: "image-pull"}},
+			}},
+		}}},
+		endpoints:  testResolver,
+		kubeletVer: version.MustParseGeneric("1.27.1"),
+	}
+
+	providers := p.credentialProviders()
+	if len(providers) != 1 {
+		t.Fatalf("credentialProviders() = %+v, want the patched ECR provider", providers)
+	}
+
+	wantImages := []string{"*.dkr.ecr.*.amazonaws.com", "*.dkr.ecr-fips.*.amazonaws.com", "ecr-cache.example.com"}
+	if !reflect.DeepEqual(providers[0].MatchImages, wantImages) {
+		t.Errorf("MatchImages = %v, want %v", providers[0].MatchImages, wantImages)
+	}
+	wantEnv := []kubelet.ExecEnvVar{{Name: "AWS_PROFILE", Value: "image-pull"}}
+	if !reflect.DeepEqual(providers[0].Env, wantEnv) {
+		t.Errorf("Env = %v, want %v", providers[0].Env, wantEnv)
+	}
+	if providers[0].APIVersion != CredentialProviderV1 || providers[0].DefaultCacheDuration.Duration != 12*time.Hour {
+		t.Errorf("Provider = %+v, want the default's API version and cache duration", providers[0])
+	}
+}
@@ -0,0 +1,189 @@
+package awsbootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Temporary credentials are refreshed this long before they expire
+const credentialRefreshMargin = 5 * time.Minute
+
+// The session name used when assuming a role, if none is configured
+const defaultSessionName = "kios-aws"
+
+// The container credentials endpoint which relative URIs are on, as
+// used by ECS
+const containerCredentialsHost = "http://169.254.170.2"
+
+// A set of AWS credentials, in the format returned by the IMDS
+// security-credentials endpoint (and the container credentials one)
+type Credentials struct {
+	AccessKeyId     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// Returns true if the credentials expire within the given time.
+// Credentials without an expiry (eg static keys) never do.
+func (c *Credentials) expiresWithin(d time.Duration) bool {
+	return !c.Expiration.IsZero() && time.Until(c.Expiration) < d
+}
+
+// Loads the temporary credentials for the instance profile's role from
+// the IMDS endpoint
+func (s *ImdsSession) GetCredentials() (*Credentials, error) {
+	roles, err := s.GetString("meta-data/iam/security-credentials/")
+	if err != nil {
+		return nil, fmt.Errorf("Could not list instance profile roles: %s", err)
+	}
+
+	role, _, _ := strings.Cut(strings.TrimSpace(roles), "\n")
+	if role == "" {
+		return nil, fmt.Errorf("Instance has no instance profile role")
+	}
+
+	raw, err := s.GetMetadata("meta-data/iam/security-credentials/" + role)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load credentials for role %s: %s", role, err)
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(raw, &creds); err != nil {
+		return nil, fmt.Errorf("Could not parse credentials for role %s: %s", role, err)
+	}
+
+	return &creds, nil
+}
+
+// Loads credentials from the standard AWS environment variables, if
+// they are set
+func EnvCredentials() (*Credentials, bool) {
+	creds := Credentials{
+		AccessKeyId:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		Token:           os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	return &creds, creds.AccessKeyId != "" && creds.SecretAccessKey != ""
+}
+
+// Loads credentials for a role using the OIDC token in the given file,
+// as with IAM Roles for Service Accounts. The file is read each time, as
+// the token in it is rotated.
+func (c *AwsClient) WebIdentityCredentials(tokenFile, roleARN, sessionName string) (*Credentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read web identity token: %s", err)
+	}
+
+	if sessionName == "" {
+		sessionName = defaultSessionName
+	}
+
+	return c.AssumeRoleWithWebIdentity(roleARN, sessionName, strings.TrimSpace(string(token)))
+}
+
+// Returns the container credentials endpoint from the environment, if
+// one is set, as with EKS Pod Identity or ECS
+func containerCredentialsURI() string {
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return uri
+	}
+
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		return containerCredentialsHost + relative
+	}
+
+	return ""
+}
+
+// Loads credentials from a container credentials endpoint. The
+// authorization token is read from AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE
+// each time, as EKS Pod Identity rotates it, or else
+// AWS_CONTAINER_AUTHORIZATION_TOKEN.
+func ContainerCredentials(client *http.Client, uri string) (*Credentials, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create request: %s", err)
+	}
+
+	token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); tokenFile != "" {
+		raw, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read container authorization token: %s", err)
+		}
+		token = strings.TrimSpace(string(raw))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not complete container credentials request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Container credentials request failed with %s", resp.Status)
+	}
+
+	var creds Credentials
+	if err := json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		return nil, fmt.Errorf("Could not parse container credentials: %s", err)
+	}
+
+	return &creds, nil
+}
+
+// Loads credentials in the same order as the AWS SDKs: the environment,
+// a web identity token (IAM Roles for Service Accounts), a container
+// credentials endpoint (EKS Pod Identity), and then the instance
+// profile. IMDS is only needed for the last of these, so the session
+// is only created if it is reached.
+func (c *AwsClient) DefaultCredentials(imds func() (*ImdsSession, error)) (*Credentials, error) {
+	if creds, ok := EnvCredentials(); ok {
+		return creds, nil
+	}
+
+	if tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); tokenFile != "" && role != "" {
+		return c.WebIdentityCredentials(tokenFile, role, os.Getenv("AWS_ROLE_SESSION_NAME"))
+	}
+
+	if uri := containerCredentialsURI(); uri != "" {
+		return ContainerCredentials(c.HTTPClient, uri)
+	}
+
+	session, err := imds()
+	if err != nil {
+		return nil, err
+	}
+
+	return session.GetCredentials()
+}
+
+// Creates a new AwsClient for long running commands. Its credentials
+// come from DefaultCredentials, and are loaded again shortly before
+// they expire.
+func NewRefreshingAwsClient(resolver *Resolver, imds func() (*ImdsSession, error)) (*AwsClient, error) {
+	client := &AwsClient{
+		Region:     resolver.Region,
+		Resolver:   resolver,
+		HTTPClient: http.DefaultClient,
+	}
+	client.Refresh = func() (*Credentials, error) {
+		return client.DefaultCredentials(imds)
+	}
+
+	if _, err := client.credentials(); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
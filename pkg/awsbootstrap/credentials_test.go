@@ -0,0 +1,256 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCredentialsRefresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		expiration  time.Time
+		wantRefresh bool
+	}{
+		{name: "no expiry"},
+		{name: "valid", expiration: time.Now().Add(time.Hour)},
+		{name: "about to expire", expiration: time.Now().Add(time.Minute), wantRefresh: true},
+		{name: "expired", expiration: time.Now().Add(-time.Minute), wantRefresh: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			refreshed := 0
+			client := &AwsClient{
+				Credentials: &Credentials{AccessKeyId: "OLD", Expiration: test.expiration},
+				Refresh: func() (*Credentials, error) {
+					refreshed++
+					return &Credentials{AccessKeyId: "NEW", Expiration: time.Now().Add(time.Hour)}, nil
+				},
+			}
+
+			for i := 0; i < 2; i++ {
+				creds, err := client.credentials()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := map[bool]string{false: "OLD", true: "NEW"}[test.wantRefresh]; creds.AccessKeyId != want {
+					t.Errorf("credentials() = %s, want %s", creds.AccessKeyId, want)
+				}
+			}
+
+			if want := map[bool]int{false: 0, true: 1}[test.wantRefresh]; refreshed != want {
+				t.Errorf("Refreshed %d times, want %d", refreshed, want)
+			}
+		})
+	}
+}
+
+func TestCredentialsRefreshFailure(t *testing.T) {
+	client := &AwsClient{Refresh: func() (*Credentials, error) {
+		return nil, fmt.Errorf("no credentials")
+	}}
+
+	if _, err := client.credentials(); err == nil {
+		t.Errorf("credentials() returned no error")
+	}
+}
+
+// Clears the credential environment variables, so that the machine the
+// tests run on does not affect them
+func clearCredentialEnv(t *testing.T) {
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID",
+		"AWS_SECRET_ACCESS_KEY",
+		"AWS_WEB_IDENTITY_TOKEN_FILE",
+		"AWS_ROLE_ARN",
+		"AWS_ROLE_SESSION_NAME",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestDefaultCredentials(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(tokenFile, []byte("web-identity-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Serves both STS and a container credentials endpoint
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == "/credentials":
+			if r.Header.Get("Authorization") != "pod-identity-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"AccessKeyId": "ASIAPOD", "SecretAccessKey": "secret", "Token": "session", "Expiration": "2030-01-01T00:00:00Z"}`)
+
+		case query.Get("Action") == "AssumeRoleWithWebIdentity":
+			// The token is the credential, so the request is not signed
+			if r.Header.Get("Authorization") != "" ||
+				query.Get("WebIdentityToken") != "web-identity-token" ||
+				query.Get("RoleArn") != "arn:aws:iam::111122223333:role/csr-approver" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+				<AccessKeyId>ASIAWEB-%s</AccessKeyId>
+				<SecretAccessKey>secret</SecretAccessKey>
+				<SessionToken>session</SessionToken>
+				<Expiration>2030-01-01T00:00:00Z</Expiration>
+			</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`, query.Get("RoleSessionName"))
+
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "environment",
+			env: map[string]string{
+				"AWS_ACCESS_KEY_ID":           "AKIDEXAMPLE",
+				"AWS_SECRET_ACCESS_KEY":       "secret",
+				"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile,
+				"AWS_ROLE_ARN":                "arn:aws:iam::111122223333:role/csr-approver",
+			},
+			want: "AKIDEXAMPLE",
+		},
+		{
+			name: "web identity",
+			env: map[string]string{
+				"AWS_WEB_IDENTITY_TOKEN_FILE":        tokenFile,
+				"AWS_ROLE_ARN":                       "arn:aws:iam::111122223333:role/csr-approver",
+				"AWS_CONTAINER_CREDENTIALS_FULL_URI": server.URL + "/credentials",
+			},
+			want: "ASIAWEB-kios-aws",
+		},
+		{
+			name: "web identity with a session name",
+			env: map[string]string{
+				"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile,
+				"AWS_ROLE_ARN":                "arn:aws:iam::111122223333:role/csr-approver",
+				"AWS_ROLE_SESSION_NAME":       "approver",
+			},
+			want: "ASIAWEB-approver",
+		},
+		{
+			name: "pod identity",
+			env: map[string]string{
+				"AWS_CONTAINER_CREDENTIALS_FULL_URI":     server.URL + "/credentials",
+				"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE": writeTempFile(t, "pod-identity-token\n"),
+			},
+			want: "ASIAPOD",
+		},
+		{
+			name: "container authorization token",
+			env: map[string]string{
+				"AWS_CONTAINER_CREDENTIALS_FULL_URI": server.URL + "/credentials",
+				"AWS_CONTAINER_AUTHORIZATION_TOKEN":  "pod-identity-token",
+			},
+			want: "ASIAPOD",
+		},
+		{
+			name: "instance profile",
+			want: "ASIAINSTANCE",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clearCredentialEnv(t)
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+
+			client := &AwsClient{
+				Region:     "eu-west-1",
+				Resolver:   testResolver,
+				HTTPClient: server.Client(),
+				Endpoints:  map[string]string{"sts": server.URL},
+			}
+			imds := func() (*ImdsSession, error) {
+				return fakeImds(t, map[string]string{
+					"meta-data/iam/security-credentials/":          "node-role",
+					"meta-data/iam/security-credentials/node-role": `{"AccessKeyId": "ASIAINSTANCE", "SecretAccessKey": "secret"}`,
+				}), nil
+			}
+
+			creds, err := client.DefaultCredentials(imds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.AccessKeyId != test.want {
+				t.Errorf("DefaultCredentials() = %s, want %s", creds.AccessKeyId, test.want)
+			}
+		})
+	}
+}
+
+func TestNewRefreshingAwsClient(t *testing.T) {
+	clearCredentialEnv(t)
+
+	// The instance profile's credentials are about to expire, so each
+	// request loads them again
+	loads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "node-role")
+		case "/latest/meta-data/iam/security-credentials/node-role":
+			loads++
+			fmt.Fprintf(w, `{"AccessKeyId": "ASIA%d", "SecretAccessKey": "secret", "Expiration": %q}`,
+				loads, time.Now().Add(time.Minute).Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewRefreshingAwsClient(testResolver, func() (*ImdsSession, error) {
+		return &ImdsSession{token: "token", Url: server.URL + "/latest/"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		creds, err := client.credentials()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("ASIA%d", i+1); creds.AccessKeyId != want {
+			t.Errorf("credentials() = %s, want %s", creds.AccessKeyId, want)
+		}
+	}
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
@@ -0,0 +1,170 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"syscall"
+
+	"k8s.io/klog/v2"
+	kubelet "k8s.io/kubelet/config/v1beta1"
+)
+
+// The filesystem backing this path is the one that kubelet and crio
+// store their images, logs and pod data on. In kiOS this is the data
+// partition, which is grown to fill the disk at boot time.
+const DataFilesystemPath = "/var/lib"
+
+const GiB = 1024 * 1024 * 1024
+
+// A set of kubelet disk settings which are appropriate for filesystems
+// of up to MaxSize bytes
+type diskTier struct {
+	MaxSize             uint64
+	ImageGCHighPercent  int32
+	ImageGCLowPercent   int32
+	ContainerLogMaxSize string
+	ContainerLogFiles   int32
+	NodefsAvailable     string
+	ImagefsAvailable    string
+}
+
+// Settings, in increasing order of disk size. Smaller disks get more
+// aggressive garbage collection and log rotation, as a single large
+// image or chatty container can quickly fill them.
+var diskTiers = []diskTier{
+	{
+		MaxSize:             16 * GiB,
+		ImageGCHighPercent:  70,
+		ImageGCLowPercent:   50,
+		ContainerLogMaxSize: "10Mi",
+		ContainerLogFiles:   2,
+		NodefsAvailable:     "15%",
+		ImagefsAvailable:    "20%",
+	},
+	{
+		MaxSize:             64 * GiB,
+		ImageGCHighPercent:  80,
+		ImageGCLowPercent:   70,
+		ContainerLogMaxSize: "20Mi",
+		ContainerLogFiles:   4,
+		NodefsAvailable:     "10%",
+		ImagefsAvailable:    "15%",
+	},
+	{
+		MaxSize:             ^uint64(0),
+		ImageGCHighPercent:  85,
+		ImageGCLowPercent:   80,
+		ContainerLogMaxSize: "50Mi",
+		ContainerLogFiles:   5,
+		NodefsAvailable:     "10%",
+		ImagefsAvailable:    "10%",
+	},
+}
+
+// Returns the total size, in bytes, of the filesystem backing the given
+// path
+func filesystemSize(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("Could not statfs %s: %s", path, err)
+	}
+
+	return stat.Blocks * uint64(stat.Bsize), nil
+}
+
+// Returns the disk settings appropriate for a filesystem of the given
+// size
+func diskTierFor(size uint64) diskTier {
+	for _, tier := range diskTiers {
+		if size <= tier.MaxSize {
+			return tier
+		}
+	}
+
+	return diskTiers[len(diskTiers)-1]
+}
+
+// Returns the image GC thresholds to use, given those set in the
+// KubeletConfiguration (if any). The kubelet refuses to start unless low
+// is below high, so if only one is set, the tier's value for the other
+// is moved out of its way.
+func imageGCThresholds(high, low *int32, tier diskTier) (int32, int32) {
+	switch {
+	case high == nil && low == nil:
+		return tier.ImageGCHighPercent, tier.ImageGCLowPercent
+	case high == nil:
+		computed := tier.ImageGCHighPercent
+		if computed <= *low {
+			computed = *low + 1
+		}
+		if computed > 100 {
+			computed = 100
+		}
+		return computed, *low
+	case low == nil:
+		computed := tier.ImageGCLowPercent
+		if computed >= *high {
+			computed = *high - 1
+		}
+		if computed < 0 {
+			computed = 0
+		}
+		return *high, computed
+	}
+
+	return *high, *low
+}
+
+// Sets the image garbage collection, eviction and container log
+// rotation settings based on the size of the data filesystem. As with
+// the other computed settings, any values which have been manually set
+// in the KubeletConfiguration are left alone.
+func tuneForDisk(kubeletConfig *kubelet.KubeletConfiguration, path string) {
+	size, err := filesystemSize(path)
+	if err != nil {
+		klog.Warningf("Could not determine disk size, using kubelet disk defaults: %s", err)
+		return
+	}
+
+	klog.Infof("Data filesystem is %.1fGiB", float64(size)/GiB)
+	applyDiskTier(kubeletConfig, diskTierFor(size))
+}
+
+// Applies a disk tier's settings to anything not already set in the
+// KubeletConfiguration
+func applyDiskTier(kubeletConfig *kubelet.KubeletConfiguration, tier diskTier) {
+	high, low := imageGCThresholds(
+		kubeletConfig.ImageGCHighThresholdPercent,
+		kubeletConfig.ImageGCLowThresholdPercent,
+		tier,
+	)
+	kubeletConfig.ImageGCHighThresholdPercent = &high
+	kubeletConfig.ImageGCLowThresholdPercent = &low
+	klog.Infof("Using image GC thresholds: high %d%%, low %d%%", high, low)
+
+	if kubeletConfig.ContainerLogMaxSize == "" {
+		kubeletConfig.ContainerLogMaxSize = tier.ContainerLogMaxSize
+	}
+	if kubeletConfig.ContainerLogMaxFiles == nil {
+		kubeletConfig.ContainerLogMaxFiles = &tier.ContainerLogFiles
+	}
+	klog.Infof(
+		"Using container log rotation: %s x %d files",
+		kubeletConfig.ContainerLogMaxSize,
+		*kubeletConfig.ContainerLogMaxFiles,
+	)
+
+	// The kubelet only applies its default eviction thresholds when none
+	// are set at all, so if we set any we need to set all of them.
+	if len(kubeletConfig.EvictionHard) != 0 {
+		klog.Info("Eviction thresholds are manually set")
+	} else {
+		kubeletConfig.EvictionHard = map[string]string{
+			"memory.available":   "100Mi",
+			"nodefs.available":   tier.NodefsAvailable,
+			"nodefs.inodesFree":  "5%",
+			"imagefs.available":  tier.ImagefsAvailable,
+			"imagefs.inodesFree": "5%",
+		}
+	}
+	klog.Infof("Using hard eviction thresholds: %v", kubeletConfig.EvictionHard)
+}
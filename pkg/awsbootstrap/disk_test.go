@@ -0,0 +1,76 @@
+package awsbootstrap
+
+import (
+	"testing"
+
+	kubelet "k8s.io/kubelet/config/v1beta1"
+)
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func TestDiskTierFor(t *testing.T) {
+	tests := []struct {
+		size     uint64
+		wantHigh int32
+	}{
+		{8 * GiB, 70},
+		{16 * GiB, 70},
+		{16*GiB + 1, 80},
+		{64 * GiB, 80},
+		{1024 * GiB, 85},
+	}
+
+	for _, test := range tests {
+		if got := diskTierFor(test.size); got.ImageGCHighPercent != test.wantHigh {
+			t.Errorf("diskTierFor(%d) high = %d, want %d", test.size, got.ImageGCHighPercent, test.wantHigh)
+		}
+	}
+}
+
+func TestImageGCThresholds(t *testing.T) {
+	large := diskTierFor(100 * GiB)
+
+	tests := []struct {
+		name      string
+		high, low *int32
+		wantHigh  int32
+		wantLow   int32
+	}{
+		{"neither set", nil, nil, 85, 80},
+		{"both set", int32Ptr(90), int32Ptr(60), 90, 60},
+		{"high above the tier's low", int32Ptr(95), nil, 95, 80},
+		{"high below the tier's low", int32Ptr(75), nil, 75, 74},
+		{"low below the tier's high", nil, int32Ptr(50), 85, 50},
+		{"low above the tier's high", nil, int32Ptr(90), 91, 90},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			high, low := imageGCThresholds(test.high, test.low, large)
+			if high != test.wantHigh || low != test.wantLow {
+				t.Errorf("imageGCThresholds() = %d, %d, want %d, %d", high, low, test.wantHigh, test.wantLow)
+			}
+		})
+	}
+}
+
+func TestApplyDiskTier(t *testing.T) {
+	config := kubelet.KubeletConfiguration{
+		ImageGCHighThresholdPercent: int32Ptr(75),
+		ContainerLogMaxSize:         "1Gi",
+		EvictionHard:                map[string]string{"memory.available": "1Gi"},
+	}
+	applyDiskTier(&config, diskTierFor(100*GiB))
+
+	if *config.ImageGCHighThresholdPercent != 75 || *config.ImageGCLowThresholdPercent >= 75 {
+		t.Errorf("Image GC thresholds = %d, %d", *config.ImageGCHighThresholdPercent, *config.ImageGCLowThresholdPercent)
+	}
+	if config.ContainerLogMaxSize != "1Gi" || *config.ContainerLogMaxFiles != 5 {
+		t.Errorf("Container log rotation = %s x %d", config.ContainerLogMaxSize, *config.ContainerLogMaxFiles)
+	}
+	if len(config.EvictionHard) != 1 {
+		t.Errorf("EvictionHard = %v, want it left alone", config.EvictionHard)
+	}
+}
@@ -0,0 +1,340 @@
+package awsbootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	credentialprovider "k8s.io/kubelet/pkg/apis/credentialprovider/v1beta1"
+)
+
+// ECR auth tokens last 12 hours. The kubelet is told to cache them for a
+// little less than however long they have left, so that it never uses
+// an expired one.
+const ecrTokenExpiryMargin = 15 * time.Minute
+
+// The session name used when assuming a role to pull images
+const ecrSessionName = "ecr-credential-provider"
+
+// An ECR registry, as found in the host name of its images, eg
+// 111122223333.dkr.ecr.eu-west-1.amazonaws.com
+type ECRRegistry struct {
+	Host    string
+	Account string
+	Region  string
+	FIPS    bool
+}
+
+// Parses an ECR registry host name
+func ParseECRRegistry(host string) (*ECRRegistry, error) {
+	parts := strings.SplitN(host, ".", 5)
+	if len(parts) != 5 || parts[1] != "dkr" || (parts[2] != "ecr" && parts[2] != "ecr-fips") {
+		return nil, fmt.Errorf("%s is not an ECR registry", host)
+	}
+
+	return &ECRRegistry{
+		Host:    host,
+		Account: parts[0],
+		Region:  parts[3],
+		FIPS:    parts[2] == "ecr-fips",
+	}, nil
+}
+
+// Flags which can be given more than once, as key=value pairs
+type mapFlag map[string]string
+
+func (m mapFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m mapFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" || val == "" {
+		return fmt.Errorf("%s is not in the key=value format", value)
+	}
+
+	m[key] = val
+	return nil
+}
+
+// Configuration for the ECR credential provider
+type ECRCredentialProviderOptions struct {
+	// A role to assume for all registries, unless one is set for the
+	// registry in RegistryRoles
+	RoleARN string `json:"roleARN,omitempty"`
+
+	// Roles to assume, keyed by account ID or registry host
+	RegistryRoles map[string]string `json:"registryRoles,omitempty"`
+
+	// Image prefixes which are served by an ECR registry, eg pull through
+	// cache repositories on a custom domain. Keys are a host, optionally
+	// followed by a path prefix, and values the ECR registry host.
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+// Returns the arguments which pass these options to the provider. Map
+// flags are sorted so that the config does not change between boots.
+func (o ECRCredentialProviderOptions) Args() []string {
+	var args []string
+	if o.RoleARN != "" {
+		args = append(args, "--role-arn", o.RoleARN)
+	}
+	for _, flag := range []struct {
+		name   string
+		values map[string]string
+	}{{"--registry-role", o.RegistryRoles}, {"--alias", o.Aliases}} {
+		keys := make([]string, 0, len(flag.values))
+		for key := range flag.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			args = append(args, flag.name, key+"="+flag.values[key])
+		}
+	}
+
+	return args
+}
+
+// Returns the alias (if any) that the image is under, and the host name
+// of the registry which serves it. The longest matching alias wins.
+func resolveECRImage(image string, aliases map[string]string) (string, string) {
+	image = strings.TrimPrefix(strings.TrimPrefix(image, "https://"), "http://")
+	host, _, _ := strings.Cut(image, "/")
+
+	match := ""
+	for alias := range aliases {
+		if (image == alias || strings.HasPrefix(image, alias+"/") || host == alias) && len(alias) > len(match) {
+			match = alias
+		}
+	}
+
+	if match != "" {
+		return match, aliases[match]
+	}
+
+	return "", host
+}
+
+// Loads an ECR authorization token, returning the username, password
+// and when it expires
+func (c *AwsClient) GetECRAuthorizationToken() (string, string, time.Time, error) {
+	var output struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+
+	err := c.callJSON("ecr", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken", map[string]interface{}{}, &output)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+
+	if len(output.AuthorizationData) == 0 {
+		return "", "", time.Time{}, fmt.Errorf("ECR returned no authorization data")
+	}
+
+	data := output.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("Could not decode ECR authorization token: %s", err)
+	}
+
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", time.Time{}, fmt.Errorf("ECR authorization token is not in the username:password format")
+	}
+
+	return username, password, time.Unix(int64(data.ExpiresAt), 0), nil
+}
+
+// The ECR credential provider, as run by the kubelet
+type ecrCredentialProvider struct {
+	roleARN       string
+	registryRoles mapFlag
+	aliases       mapFlag
+	fips          bool
+	endpoint      string
+	stsEndpoint   string
+
+	imds *ImdsSession
+}
+
+// Returns the role to assume for the given registry, if any
+func (e *ecrCredentialProvider) role(registry *ECRRegistry) string {
+	if role, ok := e.registryRoles[registry.Host]; ok {
+		return role
+	}
+	if role, ok := e.registryRoles[registry.Account]; ok {
+		return role
+	}
+
+	return e.roleARN
+}
+
+// Returns the IMDS session, creating it on first use. IMDS is only
+// needed if credentials do not come from the environment or a shared
+// config profile.
+func (e *ecrCredentialProvider) imdsSession() (*ImdsSession, error) {
+	if e.imds == nil {
+		imds, err := NewImdsSession(30)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create IMDS Session: %s", err)
+		}
+		e.imds = imds
+	}
+
+	return e.imds, nil
+}
+
+// Loads the provider's own credentials. As with the AWS SDKs, those in
+// the environment take precedence, followed by the shared config
+// profile named by AWS_PROFILE, and then the instance profile.
+func (e *ecrCredentialProvider) credentials(client *AwsClient) (*Credentials, error) {
+	if creds, ok := EnvCredentials(); ok {
+		return creds, nil
+	}
+
+	if profile := SharedConfigProfile(); profile != "" {
+		return ProfileCredentials(profile, client, e.imdsSession)
+	}
+
+	imds, err := e.imdsSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return imds.GetCredentials()
+}
+
+// Returns a client for the given registry's region, with credentials
+// for its role
+func (e *ecrCredentialProvider) client(registry *ECRRegistry) (*AwsClient, error) {
+	resolver, err := NewResolver(registry.Region, e.fips || registry.FIPS)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &AwsClient{
+		Region:     resolver.Region,
+		Resolver:   resolver,
+		HTTPClient: http.DefaultClient,
+		Endpoints:  make(map[string]string),
+	}
+	if e.endpoint != "" {
+		client.Endpoints["ecr"] = e.endpoint
+	}
+	if e.stsEndpoint != "" {
+		client.Endpoints["sts"] = e.stsEndpoint
+	}
+
+	if client.Credentials, err = e.credentials(client); err != nil {
+		return nil, fmt.Errorf("Could not load credentials: %s", err)
+	}
+
+	if role := e.role(registry); role != "" {
+		if client.Credentials, err = client.AssumeRole(role, ecrSessionName, ""); err != nil {
+			return nil, fmt.Errorf("Could not assume role %s: %s", role, err)
+		}
+	}
+
+	return client, nil
+}
+
+// Responds to a CredentialProviderRequest from the kubelet
+func (e *ecrCredentialProvider) getCredentials(request *credentialprovider.CredentialProviderRequest) (*credentialprovider.CredentialProviderResponse, error) {
+	alias, host := resolveECRImage(request.Image, e.aliases)
+
+	registry, err := ParseECRRegistry(host)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := e.client(registry)
+	if err != nil {
+		return nil, err
+	}
+
+	username, password, expiresAt, err := client.GetECRAuthorizationToken()
+	if err != nil {
+		return nil, err
+	}
+
+	cacheDuration := (time.Until(expiresAt) - ecrTokenExpiryMargin).Truncate(time.Second)
+	if cacheDuration < 0 {
+		cacheDuration = 0
+	}
+
+	// Credentials are normally cached per registry, but aliases with a
+	// path may share a host with other aliases for other registries
+	key := host
+	cacheKeyType := credentialprovider.RegistryPluginCacheKeyType
+	if alias != "" {
+		key = alias
+		if strings.Contains(alias, "/") {
+			cacheKeyType = credentialprovider.ImagePluginCacheKeyType
+		}
+	}
+
+	return &credentialprovider.CredentialProviderResponse{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: request.APIVersion,
+			Kind:       "CredentialProviderResponse",
+		},
+		CacheKeyType:  cacheKeyType,
+		CacheDuration: &metav1.Duration{Duration: cacheDuration},
+		Auth: map[string]credentialprovider.AuthConfig{
+			key: {Username: username, Password: password},
+		},
+	}, nil
+}
+
+// Runs the ECR credential provider. The kubelet runs this with the
+// get-credentials argument, and a CredentialProviderRequest on stdin.
+// Any version of the credential provider API is accepted, as they only
+// differ in name, and the response uses the same version as the
+// request.
+func RunECRCredentialProvider() {
+	args := os.Args[2:]
+	if len(args) == 0 || args[0] != "get-credentials" {
+		fatalf("Usage: ecr-credential-provider get-credentials [flags]")
+	}
+
+	provider := ecrCredentialProvider{
+		registryRoles: make(mapFlag),
+		aliases:       make(mapFlag),
+	}
+
+	flags := flag.NewFlagSet("ecr-credential-provider", flag.ExitOnError)
+	flags.StringVar(&provider.roleARN, "role-arn", "", "A role to assume before getting credentials")
+	flags.Var(provider.registryRoles, "registry-role", "A role to assume for a registry, as account-or-registry=role-arn")
+	flags.Var(provider.aliases, "alias", "An image prefix served by an ECR registry, as host[/path]=registry")
+	flags.BoolVar(&provider.fips, "fips", os.Getenv("AWS_USE_FIPS_ENDPOINT") == "true", "Use FIPS endpoints")
+	flags.StringVar(&provider.endpoint, "endpoint", "", "The ECR API endpoint to use instead of the regional one")
+	flags.StringVar(&provider.stsEndpoint, "sts-endpoint", "", "The STS endpoint to use instead of the regional one")
+	flags.Parse(args[1:])
+
+	var request credentialprovider.CredentialProviderRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
+		fatalf("Could not parse CredentialProviderRequest: %s", err)
+	}
+
+	response, err := provider.getCredentials(&request)
+	if err != nil {
+		fatalf("Could not get credentials for %s: %s", request.Image, err)
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(response); err != nil {
+		klog.Errorf("Could not write CredentialProviderResponse: %s", err)
+	}
+}
@@ -0,0 +1,258 @@
+package awsbootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	kubelet "k8s.io/kubelet/config/v1beta1"
+	credentialprovider "k8s.io/kubelet/pkg/apis/credentialprovider/v1beta1"
+)
+
+var sigV4CredentialPattern = regexp.MustCompile(`Credential=([^/]+)/\d+/([^/]+)/([^/]+)/`)
+
+// A fake ECR and STS. Roles can be assumed with any credentials, and
+// the authorization token's password says who it was issued to, as
+// "<access key>@<region>".
+func fakeECR(t *testing.T, expiresAt time.Time) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signer := sigV4CredentialPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+		if signer == nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch {
+		case signer[3] == "sts" && r.URL.Query().Get("Action") == "AssumeRole":
+			role := r.URL.Query().Get("RoleArn")
+			fmt.Fprintf(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>
+				<AccessKeyId>%s</AccessKeyId>
+				<SecretAccessKey>secret</SecretAccessKey>
+				<SessionToken>session</SessionToken>
+				<Expiration>2030-01-01T00:00:00Z</Expiration>
+			</Credentials></AssumeRoleResult></AssumeRoleResponse>`, role[strings.LastIndex(role, "/")+1:])
+
+		case signer[3] == "ecr" && r.Header.Get("X-Amz-Target") == "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken":
+			token := base64.StdEncoding.EncodeToString([]byte("AWS:" + signer[1] + "@" + signer[2]))
+			fmt.Fprintf(w, `{"authorizationData": [{"authorizationToken": %q, "expiresAt": %d}]}`, token, expiresAt.Unix())
+
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestECRGetCredentials(t *testing.T) {
+	tests := []struct {
+		name      string
+		image     string
+		provider  ecrCredentialProvider
+		env       bool
+		wantKey   string
+		wantType  credentialprovider.PluginCacheKeyType
+		wantAuth  string
+		wantError bool
+	}{
+		{
+			name:     "instance profile",
+			image:    "111122223333.dkr.ecr.eu-west-1.amazonaws.com/app:latest",
+			wantKey:  "111122223333.dkr.ecr.eu-west-1.amazonaws.com",
+			wantType: credentialprovider.RegistryPluginCacheKeyType,
+			wantAuth: "ASIAINSTANCE@eu-west-1",
+		},
+		{
+			name:     "env credentials",
+			image:    "111122223333.dkr.ecr.us-east-2.amazonaws.com/app",
+			env:      true,
+			wantKey:  "111122223333.dkr.ecr.us-east-2.amazonaws.com",
+			wantType: credentialprovider.RegistryPluginCacheKeyType,
+			wantAuth: "AKIDEXAMPLE@us-east-2",
+		},
+		{
+			name:     "default role",
+			image:    "111122223333.dkr.ecr.eu-west-1.amazonaws.com/app",
+			provider: ecrCredentialProvider{roleARN: "arn:aws:iam::111122223333:role/default"},
+			wantKey:  "111122223333.dkr.ecr.eu-west-1.amazonaws.com",
+			wantType: credentialprovider.RegistryPluginCacheKeyType,
+			wantAuth: "default@eu-west-1",
+		},
+		{
+			name:  "role by account",
+			image: "444455556666.dkr.ecr.eu-west-1.amazonaws.com/app",
+			provider: ecrCredentialProvider{
+				roleARN:       "arn:aws:iam::111122223333:role/default",
+				registryRoles: mapFlag{"444455556666": "arn:aws:iam::444455556666:role/by-account"},
+			},
+			wantKey:  "444455556666.dkr.ecr.eu-west-1.amazonaws.com",
+			wantType: credentialprovider.RegistryPluginCacheKeyType,
+			wantAuth: "by-account@eu-west-1",
+		},
+		{
+			name:  "role by registry",
+			image: "444455556666.dkr.ecr.us-east-2.amazonaws.com/app",
+			provider: ecrCredentialProvider{
+				registryRoles: mapFlag{
+					"444455556666": "arn:aws:iam::444455556666:role/by-account",
+					"444455556666.dkr.ecr.us-east-2.amazonaws.com": "arn:aws:iam::444455556666:role/by-registry",
+				},
+			},
+			wantKey:  "444455556666.dkr.ecr.us-east-2.amazonaws.com",
+			wantType: credentialprovider.RegistryPluginCacheKeyType,
+			wantAuth: "by-registry@us-east-2",
+		},
+		{
+			name:     "host alias",
+			image:    "ecr.example.com/app",
+			provider: ecrCredentialProvider{aliases: mapFlag{"ecr.example.com": "111122223333.dkr.ecr.eu-west-1.amazonaws.com"}},
+			wantKey:  "ecr.example.com",
+			wantType: credentialprovider.RegistryPluginCacheKeyType,
+			wantAuth: "ASIAINSTANCE@eu-west-1",
+		},
+		{
+			name:  "path alias",
+			image: "images.example.com/docker-hub/library/nginx",
+			provider: ecrCredentialProvider{aliases: mapFlag{
+				"images.example.com":            "111122223333.dkr.ecr.eu-west-1.amazonaws.com",
+				"images.example.com/docker-hub": "444455556666.dkr.ecr.us-east-2.amazonaws.com",
+			}},
+			wantKey:  "images.example.com/docker-hub",
+			wantType: credentialprovider.ImagePluginCacheKeyType,
+			wantAuth: "ASIAINSTANCE@us-east-2",
+		},
+		{
+			name:      "not ECR",
+			image:     "docker.io/library/nginx",
+			wantError: true,
+		},
+	}
+
+	server := fakeECR(t, time.Now().Add(12*time.Hour))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.env {
+				t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+				t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+			} else {
+				t.Setenv("AWS_ACCESS_KEY_ID", "")
+			}
+
+			provider := test.provider
+			provider.endpoint = server.URL
+			provider.stsEndpoint = server.URL
+			provider.imds = fakeImds(t, map[string]string{
+				"meta-data/iam/security-credentials/":          "node-role",
+				"meta-data/iam/security-credentials/node-role": `{"AccessKeyId": "ASIAINSTANCE", "SecretAccessKey": "secret"}`,
+			})
+
+			response, err := provider.getCredentials(&credentialprovider.CredentialProviderRequest{Image: test.image})
+			if test.wantError {
+				if err == nil {
+					t.Errorf("getCredentials() = %+v, want an error", response)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			auth, ok := response.Auth[test.wantKey]
+			if len(response.Auth) != 1 || !ok || auth.Username != "AWS" || auth.Password != test.wantAuth {
+				t.Errorf("Auth = %+v, want %s: AWS:%s", response.Auth, test.wantKey, test.wantAuth)
+			}
+			if response.CacheKeyType != test.wantType {
+				t.Errorf("CacheKeyType = %s, want %s", response.CacheKeyType, test.wantType)
+			}
+
+			// The token lasts 12 hours, less the safety margin
+			if d := response.CacheDuration.Duration; d > 12*time.Hour-ecrTokenExpiryMargin || d < 12*time.Hour-ecrTokenExpiryMargin-time.Minute {
+				t.Errorf("CacheDuration = %s", d)
+			}
+		})
+	}
+}
+
+func TestECRCredentialProviderResponse(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	// A token which has already expired should not be cached
+	server := fakeECR(t, time.Now().Add(-time.Minute))
+	provider := ecrCredentialProvider{endpoint: server.URL}
+
+	response, err := provider.getCredentials(&credentialprovider.CredentialProviderRequest{
+		Image: "111122223333.dkr.ecr.eu-west-1.amazonaws.com/app",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.APIVersion = CredentialProviderV1
+
+	raw, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"kind":"CredentialProviderResponse","apiVersion":"credentialprovider.kubelet.k8s.io/v1",` +
+		`"cacheKeyType":"Registry","cacheDuration":"0s",` +
+		`"auth":{"111122223333.dkr.ecr.eu-west-1.amazonaws.com":{"username":"AWS","password":"AKIDEXAMPLE@eu-west-1"}}}`
+	if string(raw) != want {
+		t.Errorf("CredentialProviderResponse = %s\nwant %s", raw, want)
+	}
+}
+
+func TestECRCredentialProviderProfile(t *testing.T) {
+	sharedConfigFiles(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_PROFILE", "chained")
+
+	server := fakeECR(t, time.Now().Add(12*time.Hour))
+	for _, test := range []struct {
+		provider ecrCredentialProvider
+		want     string
+	}{
+		// The fake STS names credentials after the role
+		{ecrCredentialProvider{}, "chained@eu-west-1"},
+		{ecrCredentialProvider{roleARN: "arn:aws:iam::111122223333:role/image-pull"}, "image-pull@eu-west-1"},
+	} {
+		provider := test.provider
+		provider.endpoint = server.URL
+		provider.stsEndpoint = server.URL
+
+		response, err := provider.getCredentials(&credentialprovider.CredentialProviderRequest{
+			Image: "111122223333.dkr.ecr.eu-west-1.amazonaws.com/app",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if auth := response.Auth["111122223333.dkr.ecr.eu-west-1.amazonaws.com"]; auth.Password != test.want {
+			t.Errorf("Auth = %+v, want AWS:%s", response.Auth, test.want)
+		}
+	}
+}
+
+func TestECRCredentialProviderEnv(t *testing.T) {
+	p := &Provider{
+		config:    &MetadataInformation{},
+		endpoints: testResolver,
+	}
+
+	for _, name := range []string{"AWS_USE_FIPS_ENDPOINT", "AWS_PROFILE", "AWS_CONFIG_FILE", "AWS_SHARED_CREDENTIALS_FILE"} {
+		provider := patchCredentialProvider(p.ecrCredentialProvider(), kubelet.CredentialProvider{
+			Env: []kubelet.ExecEnvVar{{Name: name, Value: "x"}},
+		})
+
+		if problems := credentialProviderProblems(provider, nil); len(problems) != 0 {
+			t.Errorf("credentialProviderProblems(%s) = %v, want none", name, problems)
+		}
+	}
+}
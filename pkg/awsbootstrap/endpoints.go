@@ -0,0 +1,123 @@
+package awsbootstrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// How long to wait for each API server endpoint to respond
+var endpointProbeTimeout = 5 * time.Second
+
+// Returns the API server endpoints to choose from, in order of
+// preference
+func (p *Provider) endpointCandidates() ([]string, error) {
+	apiServer := p.config.ApiServer
+	if len(apiServer.Endpoints) != 0 {
+		if apiServer.Endpoint != "" {
+			return nil, fmt.Errorf("Only one of endpoint and endpoints can be set")
+		}
+
+		return apiServer.Endpoints, nil
+	}
+
+	if apiServer.Endpoint == "" {
+		return nil, fmt.Errorf("No API server endpoint was given")
+	}
+
+	return []string{apiServer.Endpoint}, nil
+}
+
+// Checks that an endpoint is an API server we trust, and that it is
+// ready. The TLS handshake has to succeed against the cluster CA, then
+// /readyz must report ready. Clusters which do not allow anonymous
+// access answer /readyz with 401 or 403, which is still good enough to
+// know the API server is there.
+func probeEndpoint(endpoint string, roots *x509.CertPool) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("Not an https URL")
+	}
+
+	client := http.Client{
+		Timeout: endpointProbeTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(strings.TrimSuffix(endpoint, "/") + "/readyz")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		klog.Infof("API server endpoint %s does not allow anonymous readiness checks, assuming it is ready", endpoint)
+		return nil
+	}
+
+	return fmt.Errorf("/readyz returned %s", resp.Status)
+}
+
+// Picks the first healthy API server endpoint. The endpoints are all
+// probed at once, so unreachable ones cost one timeout between them
+// rather than one each, but the first healthy one in order of
+// preference is still used. If none are healthy, the first is used
+// anyway, as the kubelet keeps retrying and the API server may just not
+// be up yet. A single endpoint is still checked, so that any problem
+// with it is logged.
+func (p *Provider) clusterEndpoint() (string, error) {
+	if p.endpoint != "" {
+		return p.endpoint, nil
+	}
+
+	candidates, err := p.endpointCandidates()
+	if err != nil {
+		return "", err
+	}
+
+	ca, err := p.clusterCA()
+	if err != nil {
+		return "", fmt.Errorf("Could not load cluster CA to check endpoints with: %s", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca)
+
+	results := make([]chan error, len(candidates))
+	for i, candidate := range candidates {
+		results[i] = make(chan error, 1)
+		go func(candidate string, result chan<- error) {
+			result <- probeEndpoint(candidate, roots)
+		}(candidate, results[i])
+	}
+
+	// Later endpoints' probes are left to finish on their own once an
+	// earlier one is found to be healthy
+	p.endpoint = candidates[0]
+	for i, candidate := range candidates {
+		if err := <-results[i]; err != nil {
+			klog.Warningf("API server endpoint %s is not healthy: %s", candidate, err)
+			continue
+		}
+
+		p.endpoint = candidate
+		klog.Infof("Using API server endpoint %s", candidate)
+		return p.endpoint, nil
+	}
+
+	klog.Errorf("No API server endpoint is healthy, falling back to %s", p.endpoint)
+
+	return p.endpoint, nil
+}
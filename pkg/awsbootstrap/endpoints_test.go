@@ -0,0 +1,172 @@
+package awsbootstrap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Returns a self signed certificate for 127.0.0.1, and its PEM encoding
+func testServingCertificate(t *testing.T) (tls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubernetes"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// Starts an API server stand-in, with the given certificate, whose
+// /readyz returns the given status
+func fakeAPIServer(t *testing.T, cert tls.Certificate, status int) string {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+func TestClusterEndpoint(t *testing.T) {
+	clusterCert, clusterCA := testServingCertificate(t)
+	otherCert, _ := testServingCertificate(t)
+
+	ready := fakeAPIServer(t, clusterCert, http.StatusOK)
+	anotherReady := fakeAPIServer(t, clusterCert, http.StatusOK)
+	unavailable := fakeAPIServer(t, clusterCert, http.StatusServiceUnavailable)
+	unauthorized := fakeAPIServer(t, clusterCert, http.StatusUnauthorized)
+	forbidden := fakeAPIServer(t, clusterCert, http.StatusForbidden)
+	notFound := fakeAPIServer(t, clusterCert, http.StatusNotFound)
+	badCA := fakeAPIServer(t, otherCert, http.StatusOK)
+
+	tests := []struct {
+		name      string
+		endpoint  string
+		endpoints []string
+		want      string
+		wantErr   bool
+	}{
+		{name: "single endpoint", endpoint: ready, want: ready},
+		{name: "single unhealthy endpoint", endpoint: unavailable, want: unavailable},
+		{name: "single endpoint with a bad CA", endpoint: badCA, want: badCA},
+		{name: "first healthy", endpoints: []string{ready, anotherReady}, want: ready},
+		{name: "skips 503", endpoints: []string{unavailable, ready}, want: ready},
+		{name: "skips bad CA", endpoints: []string{badCA, ready}, want: ready},
+		{name: "skips 404", endpoints: []string{notFound, ready}, want: ready},
+		{name: "skips plain HTTP", endpoints: []string{"http://127.0.0.1:1", ready}, want: ready},
+		{name: "401 is healthy", endpoints: []string{unauthorized, ready}, want: unauthorized},
+		{name: "403 is healthy", endpoints: []string{forbidden, ready}, want: forbidden},
+		{name: "none healthy", endpoints: []string{badCA, unavailable}, want: badCA},
+		{name: "both set", endpoint: ready, endpoints: []string{ready}, wantErr: true},
+		{name: "none set", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Provider{config: &MetadataInformation{}, caBundle: clusterCA}
+			p.config.ApiServer.Endpoint = test.endpoint
+			p.config.ApiServer.Endpoints = test.endpoints
+
+			got, err := p.clusterEndpoint()
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("clusterEndpoint() = %s, want an error", got)
+				}
+			} else if err != nil || got != test.want {
+				t.Errorf("clusterEndpoint() = %s, %v, want %s", got, err, test.want)
+			}
+		})
+	}
+}
+
+// Starts an API server stand-in which never answers, so probing it
+// times out
+func hangingAPIServer(t *testing.T, cert tls.Certificate) string {
+	done := make(chan struct{})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+
+	// Cleanups run last first, so the handlers are released before the
+	// server waits for them
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(done) })
+
+	return server.URL
+}
+
+func TestClusterEndpointConcurrent(t *testing.T) {
+	timeout := endpointProbeTimeout
+	endpointProbeTimeout = 500 * time.Millisecond
+	t.Cleanup(func() { endpointProbeTimeout = timeout })
+
+	clusterCert, clusterCA := testServingCertificate(t)
+	ready := fakeAPIServer(t, clusterCert, http.StatusOK)
+	hanging := []string{
+		hangingAPIServer(t, clusterCert),
+		hangingAPIServer(t, clusterCert),
+		hangingAPIServer(t, clusterCert),
+	}
+
+	tests := []struct {
+		name      string
+		endpoints []string
+		want      string
+	}{
+		{name: "healthy after hanging", endpoints: append(hanging, ready), want: ready},
+		{name: "none healthy", endpoints: hanging, want: hanging[0]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Provider{config: &MetadataInformation{}, caBundle: clusterCA}
+			p.config.ApiServer.Endpoints = test.endpoints
+
+			start := time.Now()
+			got, err := p.clusterEndpoint()
+			if err != nil || got != test.want {
+				t.Errorf("clusterEndpoint() = %s, %v, want %s", got, err, test.want)
+			}
+
+			// Probed one after the other, this would take three timeouts
+			if elapsed := time.Since(start); elapsed > 2*endpointProbeTimeout {
+				t.Errorf("clusterEndpoint() took %s, want at most one probe timeout", elapsed)
+			}
+		})
+	}
+}
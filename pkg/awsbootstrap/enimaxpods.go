@@ -0,0 +1,97 @@
+package awsbootstrap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// If this file exists on the node (eg because it has been added to the
+// datapart image), it is loaded as an eni-max-pods.txt override.
+const EniMaxPodsPath = "/etc/kubernetes/eni-max-pods.txt"
+
+// The amazon-eks-ami eni-max-pods.txt values are calculated as:
+//
+//	MaxENIsPerInstance * (MaxIPsPerENI - 1) + 2
+//
+// The extra 2 accounts for aws-node and kube-proxy, which use host
+// networking. kiOS handles this with the configurable Limits.Offset
+// instead, so we take it back off when loading the file.
+const eniMaxPodsHostNetworkPods = 2
+
+// Parses a file in the amazon-eks-ami eni-max-pods.txt format. Each
+// line is an instance type followed by its max pods, separated by
+// whitespace. Blank lines and lines starting with # are ignored.
+// Malformed lines are skipped with a warning, rather than failing the
+// whole file.
+func ParseEniMaxPods(data []byte, source string) map[string]int {
+	limits := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			klog.Warningf("%s:%d: Expected \"<instance-type> <max-pods>\", got %q. Ignoring", source, lineNo, line)
+			continue
+		}
+
+		maxPods, err := strconv.Atoi(fields[1])
+		if err != nil || maxPods < eniMaxPodsHostNetworkPods {
+			klog.Warningf("%s:%d: Invalid max pods %q for %s. Ignoring", source, lineNo, fields[1], fields[0])
+			continue
+		}
+
+		if _, size := splitInstanceType(fields[0]); size == "" {
+			klog.Warningf("%s:%d: Invalid instance type %q. Ignoring", source, lineNo, fields[0])
+			continue
+		}
+
+		limits[fields[0]] = maxPods - eniMaxPodsHostNetworkPods
+	}
+
+	return limits
+}
+
+// Loads all of the configured eni-max-pods.txt sources. In increasing
+// order of precedence, these are: the file in the datapart, the
+// eniMaxPodsFrom reference and the inline eniMaxPods user data.
+func (p *Provider) loadEniMaxPods() {
+	limits := &p.config.Node.MaxPods
+	limits.eniMaxPods = make(map[string]int)
+
+	merge := func(data []byte, source string) {
+		entries := ParseEniMaxPods(data, source)
+		for instanceType, limit := range entries {
+			limits.eniMaxPods[instanceType] = limit
+		}
+		klog.Infof("Loaded %d pod limits from %s", len(entries), source)
+	}
+
+	if data, err := os.ReadFile(EniMaxPodsPath); err == nil {
+		merge(data, EniMaxPodsPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		klog.Warningf("Could not read %s: %s", EniMaxPodsPath, err)
+	}
+
+	if limits.EniMaxPodsFrom != "" {
+		if data, err := p.LoadReference(limits.EniMaxPodsFrom); err != nil {
+			klog.Warningf("Could not load eni-max-pods from %s: %s", limits.EniMaxPodsFrom, err)
+		} else {
+			merge(data, limits.EniMaxPodsFrom)
+		}
+	}
+
+	if limits.EniMaxPods != "" {
+		merge([]byte(limits.EniMaxPods), "user-data")
+	}
+}
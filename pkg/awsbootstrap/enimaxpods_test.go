@@ -0,0 +1,115 @@
+package awsbootstrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEniMaxPods(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]int
+	}{
+		{
+			name: "amazon-eks-ami format",
+			data: "# Mapping is calculated from AWS EC2 API using the following formula:\n" +
+				"# * First IP on each ENI is not used for pods\n" +
+				"\n" +
+				"m5.large 29\n" +
+				"m5.xlarge\t58\n" +
+				"  t3.micro 4  \n",
+			want: map[string]int{"m5.large": 27, "m5.xlarge": 56, "t3.micro": 2},
+		},
+		{
+			name: "malformed lines are skipped",
+			data: "m5.large 29\n" +
+				"m5.xlarge\n" +
+				"m5.2xlarge 58 extra\n" +
+				"m5.4xlarge lots\n" +
+				"m5.8xlarge 1\n" +
+				"m5.12xlarge -5\n" +
+				"m5 29\n",
+			want: map[string]int{"m5.large": 27},
+		},
+		{
+			name: "later entries win",
+			data: "m5.large 29\nm5.large 31\n",
+			want: map[string]int{"m5.large": 29},
+		},
+		{
+			name: "empty",
+			data: "",
+			want: map[string]int{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ParseEniMaxPods([]byte(test.data), "test"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseEniMaxPods() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLimitsLookup(t *testing.T) {
+	limits := Limits{
+		Overrides:  map[string]int{"m5.large": 10},
+		eniMaxPods: map[string]int{"m5.large": 20, "m5.xlarge": 30},
+	}
+
+	tests := []struct {
+		instanceType string
+		wantSource   string
+		wantLimit    int
+	}{
+		{"m5.large", MaxPodsSourceOverride, 10},
+		{"m5.xlarge", MaxPodsSourceEniMaxPods, 30},
+		{"m5.2xlarge", MaxPodsSourceCatalog, PodLimits["m5.2xlarge"]},
+		{"m99z.2xlarge", MaxPodsSourceEstimated, 0},
+		{"nonsense", MaxPodsSourceDefault, 0},
+	}
+
+	for _, test := range tests {
+		limit, source := limits.Lookup(test.instanceType)
+		if source != test.wantSource {
+			t.Errorf("Lookup(%s) source = %s, want %s", test.instanceType, source, test.wantSource)
+		}
+		if test.wantSource != MaxPodsSourceEstimated && limit != test.wantLimit {
+			t.Errorf("Lookup(%s) = %d, want %d", test.instanceType, limit, test.wantLimit)
+		}
+	}
+}
+
+func TestEstimatePodLimit(t *testing.T) {
+	known := map[string]int{
+		"m5.large":  27,
+		"m6i.large": 27,
+		"c5.large":  27,
+		"r5.large":  27,
+		"t3.large":  33,
+		"t3a.large": 33,
+		"x1.large":  50,
+	}
+
+	tests := []struct {
+		instanceType string
+		want         int
+		wantOK       bool
+	}{
+		// Same class wins over same size
+		{"t4g.large", 33, true},
+		// Otherwise the most common limit for the size
+		{"z9.large", 27, true},
+		{"m5.metal", 0, false},
+		{"m5", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := estimatePodLimit(test.instanceType, known)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("estimatePodLimit(%s) = %d, %t, want %d, %t", test.instanceType, got, ok, test.want, test.wantOK)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// The ways in which the node's hostname (and therefore its Node name)
+// can be chosen
+const (
+	// The instance's private DNS name, as reported by IMDS. This is what
+	// the aws-auth {{EC2PrivateDNSName}} placeholder expands to, so is
+	// the default.
+	HostnamePolicyPrivateDNSName = "private-dns-name"
+
+	// IP based naming, eg ip-10-0-0-1.eu-west-1.compute.internal
+	HostnamePolicyIPName = "ip-name"
+
+	// EC2 resource based naming, eg
+	// i-0123456789abcdef0.eu-west-1.compute.internal. This is the only
+	// option in IPv6-only subnets.
+	HostnamePolicyResourceName = "resource-name"
+
+	// Just the instance ID, eg i-0123456789abcdef0
+	HostnamePolicyInstanceID = "instance-id"
+
+	// The value of Node.Hostname
+	HostnamePolicyExplicit = "explicit"
+)
+
+// Returns the instance's private DNS name. If the VPC's DHCP options
+// contain several domain names, IMDS returns several space separated
+// hostnames; the first one is EC2's own.
+func (p *Provider) privateDNSName() (string, error) {
+	hostnames, err := p.imds.GetString("meta-data/hostname")
+	if err != nil {
+		return "", fmt.Errorf("Could not load private DNS name: %s", err)
+	}
+
+	fields := strings.Fields(hostnames)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("IMDS returned an empty hostname")
+	}
+
+	return fields[0], nil
+}
+
+// Works out the hostname according to the configured policy
+func (p *Provider) hostname() (string, error) {
+	policy := p.config.Node.HostnamePolicy
+	if policy == "" {
+		policy = HostnamePolicyPrivateDNSName
+	}
+
+	switch policy {
+	case HostnamePolicyPrivateDNSName:
+		return p.privateDNSName()
+
+	case HostnamePolicyIPName:
+		ip, err := p.imds.GetString("meta-data/local-ipv4")
+		if err != nil {
+			return "", fmt.Errorf("ip-name hostnames require an IPv4 address: %s", err)
+		}
+
+		return "ip-" + strings.ReplaceAll(ip, ".", "-") + "." + p.resolver().PrivateDNSDomain(), nil
+
+	case HostnamePolicyResourceName, HostnamePolicyInstanceID:
+		instanceId, err := p.imds.GetString("meta-data/instance-id")
+		if err != nil {
+			return "", fmt.Errorf("Could not determine instance ID: %s", err)
+		}
+		if policy == HostnamePolicyInstanceID {
+			return instanceId, nil
+		}
+
+		return instanceId + "." + p.resolver().PrivateDNSDomain(), nil
+
+	case HostnamePolicyExplicit:
+		if p.config.Node.Hostname == "" {
+			return "", fmt.Errorf("hostnamePolicy is explicit, but no hostname was given")
+		}
+
+		return p.config.Node.Hostname, nil
+	}
+
+	return "", fmt.Errorf("Unknown hostname policy %s", policy)
+}
+
+// Checks that the chosen hostname is a valid node name, and warns if it
+// will not match the standard aws-auth mapping for nodes.
+func (p *Provider) validateHostname(hostname string) error {
+	if errs := validation.IsDNS1123Subdomain(hostname); len(errs) != 0 {
+		return fmt.Errorf("%s is not a valid node name: %s", hostname, strings.Join(errs, ", "))
+	}
+
+	// Nodes using bootstrap tokens are not mapped through aws-auth
+	if p.authMode() != AuthModeIAMAuthenticator {
+		return nil
+	}
+
+	privateDNSName, err := p.privateDNSName()
+	if err != nil {
+		return err
+	}
+
+	if hostname != privateDNSName {
+		klog.Warningf(
+			"Hostname %s does not match the instance's private DNS name %s. The node will fail to "+
+				"authenticate if aws-auth maps its role to the username system:node:{{EC2PrivateDNSName}}",
+			hostname,
+			privateDNSName,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package awsbootstrap
+
+import "testing"
+
+// A provider for an instance in the given region, with the usual
+// hostname related metadata
+func hostnameProvider(t *testing.T, region string, node Node) *Provider {
+	return &Provider{
+		imds: fakeImds(t, map[string]string{
+			"meta-data/hostname":                 "ip-10-0-0-5." + region + ".compute.internal example.com",
+			"meta-data/local-ipv4":               "10.0.0.5",
+			"meta-data/instance-id":              "i-0123456789abcdef0",
+			"meta-data/placement/region":         region,
+			"dynamic/instance-identity/document": `{"region": "` + region + `"}`,
+		}),
+		config: &MetadataInformation{Node: node},
+	}
+}
+
+func TestHostname(t *testing.T) {
+	tests := []struct {
+		name    string
+		region  string
+		node    Node
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "default",
+			region: "eu-west-1",
+			want:   "ip-10-0-0-5.eu-west-1.compute.internal",
+		},
+		{
+			name:   "ip-name",
+			region: "eu-west-1",
+			node:   Node{HostnamePolicy: HostnamePolicyIPName},
+			want:   "ip-10-0-0-5.eu-west-1.compute.internal",
+		},
+		{
+			name:   "ip-name in us-east-1",
+			region: "us-east-1",
+			node:   Node{HostnamePolicy: HostnamePolicyIPName},
+			want:   "ip-10-0-0-5.ec2.internal",
+		},
+		{
+			name:   "resource-name",
+			region: "eu-west-1",
+			node:   Node{HostnamePolicy: HostnamePolicyResourceName},
+			want:   "i-0123456789abcdef0.eu-west-1.compute.internal",
+		},
+		{
+			name:   "resource-name in China",
+			region: "cn-north-1",
+			node:   Node{HostnamePolicy: HostnamePolicyResourceName},
+			want:   "i-0123456789abcdef0.cn-north-1.compute.internal",
+		},
+		{
+			name:   "instance-id",
+			region: "eu-west-1",
+			node:   Node{HostnamePolicy: HostnamePolicyInstanceID},
+			want:   "i-0123456789abcdef0",
+		},
+		{
+			name:   "explicit",
+			region: "eu-west-1",
+			node:   Node{HostnamePolicy: HostnamePolicyExplicit, Hostname: "worker-1"},
+			want:   "worker-1",
+		},
+		{
+			name:    "explicit without a hostname",
+			region:  "eu-west-1",
+			node:    Node{HostnamePolicy: HostnamePolicyExplicit},
+			wantErr: true,
+		},
+		{
+			name:    "unknown policy",
+			region:  "eu-west-1",
+			node:    Node{HostnamePolicy: "random"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := hostnameProvider(t, test.region, test.node).hostname()
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("hostname() = %q, want an error", got)
+				}
+			} else if err != nil || got != test.want {
+				t.Errorf("hostname() = %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	p := hostnameProvider(t, "eu-west-1", Node{})
+
+	for hostname, wantErr := range map[string]bool{
+		"ip-10-0-0-5.eu-west-1.compute.internal": false,
+		"worker-1":                               false,
+		"Worker_1":                               true,
+		"":                                       true,
+		"-worker":                                true,
+	} {
+		if err := p.validateHostname(hostname); (err != nil) != wantErr {
+			t.Errorf("validateHostname(%q) = %v, want error %t", hostname, err, wantErr)
+		}
+	}
+}
+
+func TestSessionName(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{template: "", want: "i-0123456789abcdef0"},
+		{template: "{{InstanceID}}", want: "i-0123456789abcdef0"},
+		{template: "{{EC2PrivateDNSName}}", want: "ip-10-0-0-5.eu-west-1.compute.internal"},
+		{template: "node-{{InstanceID}}", want: "node-i-0123456789abcdef0"},
+		{template: "static", want: "static"},
+		{template: "has spaces {{InstanceID}}", wantErr: true},
+		{template: "{{InstanceID}}-{{EC2PrivateDNSName}}-{{InstanceID}}", wantErr: true},
+		{template: "x", wantErr: true},
+	}
+
+	for _, test := range tests {
+		p := hostnameProvider(t, "eu-west-1", Node{})
+		p.config.ApiServer.SessionName = test.template
+
+		got, err := p.sessionName()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("sessionName(%q) = %q, want an error", test.template, got)
+			}
+		} else if err != nil || got != test.want {
+			t.Errorf("sessionName(%q) = %q, %v, want %q", test.template, got, err, test.want)
+		}
+	}
+}
@@ -1,23 +1,32 @@
 package awsbootstrap
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
+	"sync"
 
 	"k8s.io/klog/v2"
-	"sigs.k8s.io/yaml"
 )
 
 const ImdsIPv4 = "169.254.169.254"
 const ImdsIPv6 = "[fd00:ec2::254]"
 
+// Returned (wrapped) by GetMetadata for metadata which does not exist
+var ErrImdsNotFound = errors.New("Not found")
+
 // A small helper class designed to make calls to the IMDS endpoint with
-// a v2 token.
+// a v2 token. The token is refreshed whenever IMDS rejects it, as the
+// bootstrap (and the long running commands) can outlive its TTL.
 type ImdsSession struct {
+	Url string
+
+	lock  sync.Mutex
 	token string
-	Url   string
+	ttl   int
 }
 
 // Creates a new ImdsSession object with a valid token
@@ -48,7 +57,8 @@ func NewImdsSession(ttl int) (*ImdsSession, error) {
 	return s, nil
 }
 
-// Grabs a new token from the IMDSv2 endpoint with the given TTL
+// Grabs a new token from the IMDSv2 endpoint with the given TTL, which
+// is also used for any later refreshes
 func (s *ImdsSession) RefreshToken(ttl int) error {
 	req, err := http.NewRequest(http.MethodPut, s.Url+"api/token", nil)
 	if err != nil {
@@ -63,30 +73,64 @@ func (s *ImdsSession) RefreshToken(ttl int) error {
 	if err != nil {
 		return fmt.Errorf("Could not complete request: %s", err)
 	}
+	defer tokenResponse.Body.Close()
+
+	if tokenResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("Could not get an IMDS token: %s", tokenResponse.Status)
+	}
 
 	rawToken, err := io.ReadAll(tokenResponse.Body)
 	if err != nil {
 		return fmt.Errorf("Could not read token response: %s", err)
 	}
 
+	s.lock.Lock()
 	s.token = string(rawToken)
+	s.ttl = ttl
+	s.lock.Unlock()
 
 	return nil
 }
 
+// Returns the current token, and the TTL it was requested with
+func (s *ImdsSession) currentToken() (string, int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.token, s.ttl
+}
+
 // Loads arbitrary metadata from the IMDS endpoint, and returns it as
-// a byte array
+// a byte array. If the token has expired, a new one is fetched and the
+// request retried.
 func (s *ImdsSession) GetMetadata(data string) ([]byte, error) {
-	req, err := http.NewRequest("GET", s.Url+data, nil)
+	token, ttl := s.currentToken()
+	resp, err := s.get(data, token)
 	if err != nil {
-		return nil, fmt.Errorf("Could not create request: %s", err)
+		return nil, err
 	}
 
-	req.Header.Add("X-aws-ec2-metadata-token", s.token)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("Could not complete request: %s", err)
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		klog.Info("IMDS token has expired, refreshing it")
+		if err := s.RefreshToken(ttl); err != nil {
+			return nil, fmt.Errorf("Could not load %s: %s", data, err)
+		}
+
+		token, _ = s.currentToken()
+		if resp, err = s.get(data, token); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	// IMDS returns a 404 for metadata which does not exist for this
+	// instance (eg an instance without a placement group), which we
+	// don't want to mistake for an actual value.
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("Could not load %s: %w", data, ErrImdsNotFound)
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not load %s: %s", data, resp.Status)
 	}
 
 	raw, err := io.ReadAll(resp.Body)
@@ -97,6 +141,23 @@ func (s *ImdsSession) GetMetadata(data string) ([]byte, error) {
 	return raw, nil
 }
 
+// Sends a GET request for the given metadata with the given token
+func (s *ImdsSession) get(data, token string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", s.Url+data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create request: %s", err)
+	}
+
+	req.Header.Add("X-aws-ec2-metadata-token", token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Could not complete request: %s", err)
+	}
+
+	return resp, nil
+}
+
 // Loads arbitrary function from the IMDS endpoint, and returns it as a
 // string
 func (s *ImdsSession) GetString(data string) (string, error) {
@@ -108,23 +169,58 @@ func (s *ImdsSession) GetString(data string) (string, error) {
 	return string(raw), nil
 }
 
-// Loads the user data for the instance, assumes that it is YAML and
-// unmarshals it as a MetadataInformation object
+// Loads the user data for the instance, and unmarshals it as a
+// MetadataInformation object (see parseUserData)
 func (s *ImdsSession) GetUserData() (*MetadataInformation, error) {
+	// Instances launched without user data get a 404, which just means
+	// everything is left at its default
 	raw, err := s.GetMetadata("user-data")
-	if err != nil {
+	if errors.Is(err, ErrImdsNotFound) {
+		klog.Warning("Instance has no user data, using defaults")
+		raw = nil
+	} else if err != nil {
 		return nil, err
 	}
 
 	data := MetadataInformation{
 		Node: Node{
+			KubeletValidationPolicy: ValidationPolicyDegrade,
 			MaxPods: Limits{
 				Set:    true,
 				Offset: 3,
 			},
 		},
 	}
-	yaml.Unmarshal(raw, &data)
+	if err := parseUserData(raw, &data); err != nil {
+		klog.Warningf("Problem reading user data: %s", err)
+	}
 
 	return &data, nil
 }
+
+// The subset of the instance identity document that we use
+type IdentityDocument struct {
+	AccountId        string `json:"accountId"`
+	Architecture     string `json:"architecture"`
+	AvailabilityZone string `json:"availabilityZone"`
+	ImageId          string `json:"imageId"`
+	InstanceId       string `json:"instanceId"`
+	InstanceType     string `json:"instanceType"`
+	PrivateIp        string `json:"privateIp"`
+	Region           string `json:"region"`
+}
+
+// Loads the instance identity document
+func (s *ImdsSession) GetIdentityDocument() (*IdentityDocument, error) {
+	raw, err := s.GetMetadata("dynamic/instance-identity/document")
+	if err != nil {
+		return nil, err
+	}
+
+	var doc IdentityDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("Could not parse instance identity document: %s", err)
+	}
+
+	return &doc, nil
+}
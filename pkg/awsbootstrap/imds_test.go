@@ -0,0 +1,140 @@
+package awsbootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// Starts a fake IMDS which serves the given paths, and 404s everything
+// else
+func fakeImds(t *testing.T, paths map[string]string) *ImdsSession {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		value, ok := paths[r.URL.Path[len("/latest/"):]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(value))
+	}))
+	t.Cleanup(server.Close)
+
+	return &ImdsSession{token: "token", Url: server.URL + "/latest/"}
+}
+
+func TestGetMetadataNotFound(t *testing.T) {
+	imds := fakeImds(t, map[string]string{"meta-data/instance-id": "i-0123456789abcdef0"})
+
+	value, err := imds.GetString("meta-data/instance-id")
+	if err != nil || value != "i-0123456789abcdef0" {
+		t.Errorf("GetString() = %q, %v", value, err)
+	}
+
+	if _, err := imds.GetString("meta-data/placement/group-name"); !errors.Is(err, ErrImdsNotFound) {
+		t.Errorf("GetString() of missing metadata returned %v, want ErrImdsNotFound", err)
+	}
+}
+
+func TestGetUserDataMissing(t *testing.T) {
+	config, err := fakeImds(t, nil).GetUserData()
+	if err != nil {
+		t.Fatalf("GetUserData() returned %v", err)
+	}
+
+	if config.Node.KubeletValidationPolicy != ValidationPolicyDegrade {
+		t.Errorf("KubeletValidationPolicy = %q, want the default", config.Node.KubeletValidationPolicy)
+	}
+	if !config.Node.MaxPods.Set || config.Node.MaxPods.Offset != 3 {
+		t.Errorf("MaxPods = %+v, want the default", config.Node.MaxPods)
+	}
+}
+
+func TestGetUserData(t *testing.T) {
+	config, err := fakeImds(t, map[string]string{"user-data": `
+apiVersion: kios.redcoat.dev/v1alpha1
+kind: MetadataInformation
+apiServer:
+  name: my-cluster
+  endpoint: https://example.com
+`}).GetUserData()
+	if err != nil {
+		t.Fatalf("GetUserData() returned %v", err)
+	}
+
+	if config.ApiServer.Name != "my-cluster" || config.ApiServer.Endpoint != "https://example.com" {
+		t.Errorf("ApiServer = %+v", config.ApiServer)
+	}
+}
+
+func TestGetMetadataRefreshesExpiredToken(t *testing.T) {
+	// A fake IMDS whose tokens are only valid until the next one is
+	// issued, or until expired is set
+	var lock sync.Mutex
+	issued, expired := 0, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			if r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") != "30" {
+				t.Errorf("Token requested with TTL %q, want 30", r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+			}
+			issued++
+			expired = false
+			fmt.Fprintf(w, "token-%d", issued)
+			return
+		}
+
+		if expired || r.Header.Get("X-aws-ec2-metadata-token") != fmt.Sprintf("token-%d", issued) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "i-0123456789abcdef0")
+	}))
+	t.Cleanup(server.Close)
+
+	imds := &ImdsSession{Url: server.URL + "/latest/"}
+	if err := imds.RefreshToken(30); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		value, err := imds.GetString("meta-data/instance-id")
+		if err != nil || value != "i-0123456789abcdef0" {
+			t.Errorf("GetString() after %d token(s) = %q, %v", issued, value, err)
+		}
+
+		lock.Lock()
+		if issued != i {
+			t.Errorf("%d token(s) were issued, want %d", issued, i)
+		}
+		expired = true
+		lock.Unlock()
+	}
+}
+
+func TestGetMetadataTokenRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	imds := &ImdsSession{Url: server.URL + "/latest/", token: "expired", ttl: 30}
+	if _, err := imds.GetString("meta-data/instance-id"); err == nil {
+		t.Errorf("GetString() returned no error when a new token could not be issued")
+	}
+}
@@ -0,0 +1,78 @@
+package awsbootstrap
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// Karpenter tags the instances it launches with the NodePool and
+// EC2NodeClass which they belong to. It then expects the node to
+// register with a matching label for each.
+const (
+	TagKarpenterNodePool     = "karpenter.sh/nodepool"
+	TagKarpenterEC2NodeClass = "karpenter.k8s.aws/ec2nodeclass"
+
+	LabelKarpenterNodePool     = "karpenter.sh/nodepool"
+	LabelKarpenterEC2NodeClass = "karpenter.k8s.aws/ec2nodeclass"
+)
+
+// Nodes launched by Karpenter must register with this taint. Karpenter
+// removes it once it has finished initialising the NodeClaim.
+var KarpenterUnregisteredTaint = v1.Taint{
+	Key:    "karpenter.sh/unregistered",
+	Effect: v1.TaintEffectNoExecute,
+}
+
+// Returns the instance's Karpenter NodePool, if it was launched by
+// Karpenter. The NodeConfig which Karpenter generates for the node
+// already carries the NodePool label, so that is used when it is there.
+// With a Custom AMI family, Karpenter passes the EC2NodeClass's user data
+// through untouched, so the NodePool can only be found from the
+// instance's tags. As that needs ec2:DescribeTags, which most node roles
+// do not have, it is only tried if the user data sets node.karpenter.
+func (p *Provider) karpenterNodePool() string {
+	if nodePool := p.config.Node.Labels[LabelKarpenterNodePool]; nodePool != "" {
+		return nodePool
+	}
+
+	if !p.config.Node.Karpenter {
+		return ""
+	}
+
+	tags, err := p.instanceTags()
+	if err != nil {
+		klog.Errorf("Cannot detect Karpenter NodePool: %s", err)
+		return ""
+	}
+
+	return tags[TagKarpenterNodePool]
+}
+
+// Adds the labels Karpenter expects a node to register with: its
+// NodePool and EC2NodeClass, plus the well known labels that NodePool
+// requirements are normally written against.
+func (p *Provider) karpenterLabels(labels map[string]string) {
+	nodePool := p.karpenterNodePool()
+	if nodePool == "" {
+		return
+	}
+
+	klog.Infof("Instance was launched by Karpenter NodePool %s", nodePool)
+
+	setLabel(labels, LabelKarpenterNodePool, nodePool)
+	setLabel(labels, LabelKarpenterEC2NodeClass, p.tags[TagKarpenterEC2NodeClass])
+
+	p.capacityTypeLabels(labels)
+	p.archLabels(labels)
+	p.instanceLabels(labels)
+	p.zoneIDLabels(labels)
+}
+
+// Returns the taints Karpenter expects a node to register with
+func (p *Provider) karpenterTaints() []v1.Taint {
+	if p.karpenterNodePool() == "" {
+		return nil
+	}
+
+	return []v1.Taint{KarpenterUnregisteredTaint}
+}
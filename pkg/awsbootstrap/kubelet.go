@@ -2,8 +2,10 @@ package awsbootstrap
 
 import (
 	"fmt"
+	"net/netip"
 	"strings"
 
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 	kubelet "k8s.io/kubelet/config/v1beta1"
 	"sigs.k8s.io/yaml"
@@ -18,7 +20,19 @@ func (p *Provider) GetKubeletConfiguration(kubeletConfig kubelet.KubeletConfigur
 	}
 
 	kubeletConfig.ServerTLSBootstrap = true
-	kubeletConfig.RegisterWithTaints = p.config.Node.Taints
+
+	// Bootstrapped client certificates are short lived, so the kubelet
+	// must renew its own
+	if p.authMode() == AuthModeBootstrapToken {
+		kubeletConfig.RotateCertificates = true
+	}
+
+	kubeletConfig.RegisterWithTaints = nil
+	for _, taints := range [][]v1.Taint{p.config.Node.Taints, p.tagTaints(), p.karpenterTaints(), p.acceleratorTaints()} {
+		for _, taint := range taints {
+			kubeletConfig.RegisterWithTaints = addTaint(kubeletConfig.RegisterWithTaints, taint)
+		}
+	}
 
 	// In the spirit on unopinionated-ness, we will accept it if a
 	// ProviderID has been specified.
@@ -29,10 +43,7 @@ func (p *Provider) GetKubeletConfiguration(kubeletConfig kubelet.KubeletConfigur
 		klog.Warning("ProviderID is manually set. Use with caution")
 	} else {
 		klog.Infof("ProviderID is not manually set. Creating EKS-expected providerID from metadata")
-
-		az, _ := p.imds.GetString("meta-data/placement/availability-zone")
-		instanceId, _ := p.imds.GetString("meta-data/instance-id")
-		kubeletConfig.ProviderID = "aws:///" + az + "/" + instanceId
+		kubeletConfig.ProviderID = p.defaultProviderID()
 	}
 	klog.Infof("Using ProviderID: %s", kubeletConfig.ProviderID)
 
@@ -42,17 +53,7 @@ func (p *Provider) GetKubeletConfiguration(kubeletConfig kubelet.KubeletConfigur
 		klog.Info("Cluster DNS is manually set")
 	} else {
 		klog.Info("Cluster DNS is not manually set, using EKS default")
-
-		// EKS' default service CIDR is 10.100.0.0/16 _unless_ the VPC CIDR is
-		// in the 10.0.0.0/8 - in this case, the service CIDR is 172.20.0.0/16.
-		// By convention, the cluster dns service cluster IP is x.x.0.10
-		ip, _ := p.imds.GetString("meta-data/local-ipv4")
-
-		if strings.HasPrefix(ip, "10.") {
-			kubeletConfig.ClusterDNS = []string{"172.20.0.10"}
-		} else {
-			kubeletConfig.ClusterDNS = []string{"10.100.0.10"}
-		}
+		kubeletConfig.ClusterDNS = p.defaultClusterDNS()
 	}
 	klog.Infof("Using Cluster DNS: %v", kubeletConfig.ClusterDNS)
 
@@ -68,10 +69,82 @@ func (p *Provider) GetKubeletConfiguration(kubeletConfig kubelet.KubeletConfigur
 	//   - The node pod
 	//   - An assumed kube-proxy DaemonSet
 	//   - An assumed aws-vpc-cni DaemonSet
+	//
+	// If the instance type is unknown, and no estimate can be made, we
+	// leave the kubelet's default in place rather than setting a limit
+	// that is just the offset.
 	if p.config.Node.MaxPods.Set {
-		instanceType, _ := p.imds.GetString("meta-data/instance-type")
-		kubeletConfig.MaxPods = int32(PodLimits[instanceType] + p.config.Node.MaxPods.Offset)
+		if maxPods, source := p.maxPods(); source != MaxPodsSourceDefault {
+			kubeletConfig.MaxPods = maxPods
+		}
+	}
+
+	p.saveNodeIPs()
+
+	// The data partition is grown to fill the disk at boot, so we only
+	// know how much space we have to play with now.
+	tuneForDisk(&kubeletConfig, DataFilesystemPath)
+
+	return p.validateKubeletConfiguration(kubeletConfig)
+}
+
+// Returns the providerID in the format expected by EKS:
+// aws:///<availability-zone>/<instance-id>
+func (p *Provider) defaultProviderID() string {
+	az, err := p.imds.GetString("meta-data/placement/availability-zone")
+	if err != nil {
+		fatalf("Could not determine availability zone for the providerID: %s", err)
+	}
+	instanceId, err := p.imds.GetString("meta-data/instance-id")
+	if err != nil {
+		fatalf("Could not determine instance ID for the providerID: %s", err)
+	}
+
+	return "aws:///" + az + "/" + instanceId
+}
+
+// Returns the cluster's service CIDR. Unless this is set in the user
+// data, we assume EKS' default service CIDR, which is 10.100.0.0/16
+// _unless_ the VPC CIDR is in the 10.0.0.0/8 - in this case, the service
+// CIDR is 172.20.0.0/16.
+func (p *Provider) serviceCIDR() (netip.Prefix, error) {
+	if p.config.ApiServer.ServiceCIDR != "" {
+		return netip.ParsePrefix(p.config.ApiServer.ServiceCIDR)
+	}
+
+	ip, _ := p.imds.GetString("meta-data/local-ipv4")
+	if strings.HasPrefix(ip, "10.") {
+		return netip.MustParsePrefix("172.20.0.0/16"), nil
+	}
+
+	return netip.MustParsePrefix("10.100.0.0/16"), nil
+}
+
+// By convention, the cluster dns service cluster IP is the tenth
+// address in the service CIDR (x.x.0.10)
+func (p *Provider) defaultClusterDNS() []string {
+	cidr, err := p.serviceCIDR()
+	if err != nil {
+		klog.Errorf("Invalid service CIDR %s: %s", p.config.ApiServer.ServiceCIDR, err)
+		return nil
+	}
+
+	ip := cidr.Masked().Addr()
+	for i := 0; i < 10; i++ {
+		ip = ip.Next()
+	}
+
+	return []string{ip.String()}
+}
+
+// Adds a taint to the list, unless a taint with the same key and effect
+// is already present
+func addTaint(taints []v1.Taint, taint v1.Taint) []v1.Taint {
+	for _, existing := range taints {
+		if existing.MatchTaint(&taint) {
+			return taints
+		}
 	}
 
-	return kubeletConfig
+	return append(taints, taint)
 }
@@ -0,0 +1,85 @@
+package awsbootstrap
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/klog/v2"
+)
+
+// The host's kubelet binary, as mounted into the bootstrap container
+var KubeletBinaryPath = "/host/usr/bin/kubelet"
+
+// Parses the output of kubelet --version, eg "Kubernetes v1.25.5"
+func parseKubeletVersion(output string) (*version.Version, error) {
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Empty version")
+	}
+
+	return version.ParseGeneric(fields[len(fields)-1])
+}
+
+// Asks the kubelet binary for its version. The binary is run from inside
+// the bootstrap container, which only works if it is statically linked,
+// so the ways this can fail are reported separately.
+func binaryKubeletVersion() (*version.Version, error) {
+	if _, err := os.Stat(KubeletBinaryPath); err != nil {
+		return nil, fmt.Errorf("Could not find the kubelet binary: %s", err)
+	}
+
+	output, err := exec.Command(KubeletBinaryPath, "--version").Output()
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return nil, fmt.Errorf("%s --version failed: %s: %s", KubeletBinaryPath, err, strings.TrimSpace(string(exitErr.Stderr)))
+	case errors.Is(err, fs.ErrNotExist):
+		// The binary exists, so it is its interpreter or dynamic loader
+		// which is missing from this container
+		return nil, fmt.Errorf("Could not run %s, as it is not statically linked: %s", KubeletBinaryPath, err)
+	case err != nil:
+		return nil, fmt.Errorf("Could not run %s --version: %s", KubeletBinaryPath, err)
+	}
+
+	return parseKubeletVersion(string(output))
+}
+
+// Returns the version of the node's kubelet. This is taken from the user
+// data if it is set there, otherwise from the kubelet binary. As a last
+// resort, we assume it matches the version of kiOS this was built for,
+// as kiOS releases follow Kubernetes'. Returns nil if the version
+// cannot be determined at all.
+func (p *Provider) kubeletVersion() *version.Version {
+	if p.kubeletVer != nil {
+		return p.kubeletVer
+	}
+
+	if configured := p.config.Node.KubeletVersion; configured != "" {
+		v, err := parseKubeletVersion(configured)
+		if err == nil {
+			p.kubeletVer = v
+			return v
+		}
+		klog.Errorf("Invalid kubeletVersion %s in user data: %s", configured, err)
+	}
+
+	v, err := binaryKubeletVersion()
+	if err != nil {
+		klog.Warningf("Could not determine the kubelet's version from its binary, assuming kiOS %s: %s", Version, err)
+		if v, err = parseKubeletVersion(Version); err != nil {
+			klog.Warningf("Could not determine the kubelet's version")
+			return nil
+		}
+	}
+
+	klog.Infof("Kubelet version is %s", v)
+	p.kubeletVer = v
+
+	return v
+}
@@ -0,0 +1,121 @@
+package awsbootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+func TestBinaryKubeletVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "static binary",
+			script: "#!/bin/sh\necho Kubernetes v1.27.3\n",
+			want:   "1.27.3",
+		},
+		{
+			name:    "failing binary",
+			script:  "#!/bin/sh\necho unknown flag >&2\nexit 1\n",
+			wantErr: "unknown flag",
+		},
+		{
+			name:    "dynamically linked binary",
+			script:  "#!/lib/ld-missing.so\n",
+			wantErr: "not statically linked",
+		},
+		{
+			name:    "missing binary",
+			wantErr: "Could not find the kubelet binary",
+		},
+	}
+
+	defer func(path string) { KubeletBinaryPath = path }(KubeletBinaryPath)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			KubeletBinaryPath = filepath.Join(t.TempDir(), "kubelet")
+			if test.script != "" {
+				if err := os.WriteFile(KubeletBinaryPath, []byte(test.script), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := binaryKubeletVersion()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("binaryKubeletVersion() = %v, %v, want an error containing %q", got, err, test.wantErr)
+				}
+			} else if err != nil || got.String() != test.want {
+				t.Errorf("binaryKubeletVersion() = %v, %v, want %s", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestKubeletSupports(t *testing.T) {
+	tests := []struct {
+		kubelet    string
+		apiVersion string
+		supported  bool
+		deprecated bool
+	}{
+		{"1.23.0", CredentialProviderV1alpha1, true, false},
+		{"1.23.0", CredentialProviderV1beta1, false, false},
+		{"1.25.5", CredentialProviderV1alpha1, true, true},
+		{"1.25.5", CredentialProviderV1beta1, true, false},
+		{"1.25.5", CredentialProviderV1, false, false},
+		{"1.26.0", CredentialProviderV1alpha1, false, true},
+		{"1.26.0", CredentialProviderV1beta1, true, true},
+		{"1.26.0", CredentialProviderV1, true, false},
+		{"", CredentialProviderV1alpha1, true, false},
+		{"1.26.0", "credentialprovider.kubelet.k8s.io/v2", false, false},
+	}
+
+	for _, test := range tests {
+		var kubeletVersion *version.Version
+		if test.kubelet != "" {
+			kubeletVersion = version.MustParseGeneric(test.kubelet)
+		}
+
+		supported, deprecated := kubeletSupports(kubeletVersion, test.apiVersion)
+		if supported != test.supported || (supported && deprecated != test.deprecated) {
+			t.Errorf("kubeletSupports(%s, %s) = %t, %t, want %t, %t", test.kubelet, test.apiVersion, supported, deprecated, test.supported, test.deprecated)
+		}
+	}
+}
+
+func TestChooseAPIVersion(t *testing.T) {
+	tests := []struct {
+		kubelet  string
+		provider []string
+		want     string
+	}{
+		{"1.25.5", ecrAPIVersions, CredentialProviderV1beta1},
+		{"1.27.3", ecrAPIVersions, CredentialProviderV1},
+		{"1.22.0", ecrAPIVersions, CredentialProviderV1alpha1},
+		{"1.27.3", []string{CredentialProviderV1alpha1}, ""},
+		{"1.19.0", ecrAPIVersions, ""},
+
+		// An unknown kubelet is assumed to be recent
+		{"", ecrAPIVersions, CredentialProviderV1},
+		{"", []string{CredentialProviderV1beta1}, CredentialProviderV1beta1},
+	}
+
+	defer func(path string) { KubeletBinaryPath = path }(KubeletBinaryPath)
+	KubeletBinaryPath = filepath.Join(t.TempDir(), "missing")
+
+	for _, test := range tests {
+		p := &Provider{config: &MetadataInformation{Node: Node{KubeletVersion: test.kubelet}}}
+		if got := p.chooseAPIVersion("test", test.provider); got != test.want {
+			t.Errorf("chooseAPIVersion(%s, %v) = %q, want %q", test.kubelet, test.provider, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package awsbootstrap
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/EmilyShepherd/kios-aws/pkg/nodemetadata"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// Labels in the kubernetes.io and k8s.io namespaces which the
+// NodeRestriction admission plugin allows the kubelet to set on itself
+var allowedKubernetesLabels = map[string]bool{
+	v1.LabelHostname:                true,
+	v1.LabelInstanceType:            true,
+	v1.LabelInstanceTypeStable:      true,
+	v1.LabelOSStable:                true,
+	v1.LabelArchStable:              true,
+	v1.LabelFailureDomainBetaZone:   true,
+	v1.LabelFailureDomainBetaRegion: true,
+	v1.LabelTopologyZone:            true,
+	v1.LabelTopologyRegion:          true,
+	"beta.kubernetes.io/os":         true,
+	"beta.kubernetes.io/arch":       true,
+}
+
+// Namespaces under kubernetes.io which the kubelet may freely set
+var allowedKubernetesNamespaces = []string{
+	"kubelet.kubernetes.io",
+	"node.kubernetes.io",
+}
+
+// Returns true if the NodeRestriction admission plugin will reject the
+// kubelet setting this label on its own Node
+func isRestrictedLabel(key string) bool {
+	namespace, _, ok := strings.Cut(key, "/")
+	if !ok || allowedKubernetesLabels[key] {
+		return false
+	}
+
+	if namespace == "node-restriction.kubernetes.io" || strings.HasSuffix(namespace, ".node-restriction.kubernetes.io") {
+		return true
+	}
+
+	for _, allowed := range allowedKubernetesNamespaces {
+		if namespace == allowed || strings.HasSuffix(namespace, "."+allowed) {
+			return false
+		}
+	}
+
+	for _, restricted := range []string{"kubernetes.io", "k8s.io"} {
+		if namespace == restricted || strings.HasSuffix(namespace, "."+restricted) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Removes any labels which do not meet the Kubernetes syntax rules, as
+// a single bad label would stop the node from registering
+func validLabels(labels map[string]string) map[string]string {
+	valid := make(map[string]string)
+	for key, value := range labels {
+		errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...)
+		if len(errs) != 0 {
+			klog.Errorf("Dropping invalid label %s=%s: %s", key, value, strings.Join(errs, ", "))
+			continue
+		}
+
+		valid[key] = value
+	}
+
+	return valid
+}
+
+// Splits labels into those the kubelet is allowed to set on itself, and
+// those that must be applied by something else after registration
+func partitionLabels(labels map[string]string) (map[string]string, map[string]string) {
+	allowed := make(map[string]string)
+	restricted := make(map[string]string)
+
+	for key, value := range labels {
+		if isRestrictedLabel(key) {
+			restricted[key] = value
+		} else {
+			allowed[key] = value
+		}
+	}
+
+	return allowed, restricted
+}
+
+// Reports the labels which the kubelet cannot set on itself. These are
+// saved, along with the node's annotations, for the node metadata
+// helper to apply once the node has registered. The metadata file is
+// always written, so that metadata from a previous boot is not
+// reapplied.
+func (p *Provider) saveNodeMetadata(restricted map[string]string) {
+	for key, value := range restricted {
+		klog.Warningf("Label %s=%s is restricted by NodeRestriction and cannot be set by the kubelet", key, value)
+	}
+
+	// The privileged kubeconfig can patch any Node, so it is only kept on
+	// disk while there are restricted labels to apply
+	if len(restricted) == 0 || !p.savePrivilegedKubeconfig() {
+		removePrivilegedKubeconfig()
+	}
+
+	metadata := nodemetadata.NodeMetadata{
+		RestrictedLabels: restricted,
+		Annotations:      p.nodeAnnotations(),
+	}
+	if err := metadata.Save(); err != nil {
+		klog.Error(err.Error())
+	}
+}
+
+// Saves the privileged kubeconfig from the user data, if there is one,
+// for the node metadata helper to use. Returns whether it was saved.
+func (p *Provider) savePrivilegedKubeconfig() bool {
+	ref := p.config.Node.PrivilegedKubeconfig
+	if ref == "" {
+		klog.Warning("node.privilegedKubeconfig is not set, so restricted labels will not be applied")
+		return false
+	}
+
+	kubeconfig, err := p.LoadReference(ref)
+	if err != nil {
+		klog.Errorf("Could not load privileged kubeconfig from %s: %s", ref, err)
+		return false
+	}
+
+	if err := os.WriteFile(nodemetadata.PrivilegedKubeconfigPath, kubeconfig, 0600); err != nil {
+		klog.Errorf("Could not save privileged kubeconfig: %s", err)
+		return false
+	}
+
+	return true
+}
+
+// Removes any privileged kubeconfig left over from a previous boot
+func removePrivilegedKubeconfig() {
+	err := os.Remove(nodemetadata.PrivilegedKubeconfigPath)
+	if err == nil {
+		klog.Infof("Removed stale privileged kubeconfig %s", nodemetadata.PrivilegedKubeconfigPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		klog.Errorf("Could not remove stale privileged kubeconfig: %s", err)
+	}
+}
@@ -0,0 +1,81 @@
+package awsbootstrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsRestrictedLabel(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"team", false},
+		{"example.com/team", false},
+		{"kubernetes.io/hostname", false},
+		{"topology.kubernetes.io/zone", false},
+		{"node.kubernetes.io/instance-type", false},
+		{"node.kubernetes.io/exclude-from-external-load-balancers", false},
+		{"kubelet.kubernetes.io/anything", false},
+		{"foo.node.kubernetes.io/anything", false},
+		{"beta.kubernetes.io/arch", false},
+		{"node-role.kubernetes.io/worker", true},
+		{"kubernetes.io/role", true},
+		{"eks.amazonaws.com/nodegroup", false},
+		{"k8s.io/cluster-autoscaler", true},
+		{"example.k8s.io/thing", true},
+		{"node-restriction.kubernetes.io/pci", true},
+		{"example.node-restriction.kubernetes.io/pci", true},
+		{"topology.kios.aws/vpc-id", false},
+		{"notkubernetes.io/thing", false},
+	}
+
+	for _, test := range tests {
+		if got := isRestrictedLabel(test.key); got != test.want {
+			t.Errorf("isRestrictedLabel(%s) = %t, want %t", test.key, got, test.want)
+		}
+	}
+}
+
+func TestPartitionLabels(t *testing.T) {
+	allowed, restricted := partitionLabels(map[string]string{
+		"team":                               "platform",
+		"topology.kubernetes.io/zone":        "eu-west-1a",
+		"node-role.kubernetes.io/worker":     "",
+		"karpenter.sh/nodepool":              "default",
+		"node-restriction.kubernetes.io/pci": "true",
+	})
+
+	wantAllowed := map[string]string{
+		"team":                        "platform",
+		"topology.kubernetes.io/zone": "eu-west-1a",
+		"karpenter.sh/nodepool":       "default",
+	}
+	wantRestricted := map[string]string{
+		"node-role.kubernetes.io/worker":     "",
+		"node-restriction.kubernetes.io/pci": "true",
+	}
+
+	if !reflect.DeepEqual(allowed, wantAllowed) {
+		t.Errorf("allowed = %v, want %v", allowed, wantAllowed)
+	}
+	if !reflect.DeepEqual(restricted, wantRestricted) {
+		t.Errorf("restricted = %v, want %v", restricted, wantRestricted)
+	}
+}
+
+func TestValidLabels(t *testing.T) {
+	got := validLabels(map[string]string{
+		"team":              "platform",
+		"example.com/empty": "",
+		"bad key":           "x",
+		"/no-prefix":        "x",
+		"example.com/value": "not a valid value",
+		"example.com/long":  "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+	})
+
+	want := map[string]string{"team": "platform", "example.com/empty": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("validLabels() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+package awsbootstrap
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// Label keys emitted by the optional label sets. These are considered
+// stable: changing them would break anyone selecting on them.
+const (
+	LabelZoneID = "topology.k8s.aws/zone-id"
+
+	LabelCapacityType    = "karpenter.sh/capacity-type"
+	LabelEKSCapacityType = "eks.amazonaws.com/capacityType"
+
+	LabelInstanceCategory   = "karpenter.k8s.aws/instance-category"
+	LabelInstanceFamily     = "karpenter.k8s.aws/instance-family"
+	LabelInstanceGeneration = "karpenter.k8s.aws/instance-generation"
+	LabelInstanceSize       = "karpenter.k8s.aws/instance-size"
+
+	LabelAMIID = "kios.redcoat.dev/ami-id"
+
+	LabelPlacementGroup     = "kios.redcoat.dev/placement-group"
+	LabelPlacementPartition = "kios.redcoat.dev/placement-partition"
+
+	LabelTenancy = "kios.redcoat.dev/tenancy"
+	LabelHostID  = "kios.redcoat.dev/host-id"
+)
+
+// The label sets which can be enabled via Node.LabelSets
+const (
+	LabelSetZoneID       = "zone-id"
+	LabelSetCapacityType = "capacity-type"
+	LabelSetArch         = "arch"
+	LabelSetAMI          = "ami"
+	LabelSetInstance     = "instance"
+	LabelSetPlacement    = "placement"
+	LabelSetTenancy      = "tenancy"
+	LabelSetNetwork      = "network"
+)
+
+// Maps each label set to the function which generates its labels
+var labelSets = map[string]func(p *Provider, labels map[string]string){
+	LabelSetZoneID:       (*Provider).zoneIDLabels,
+	LabelSetCapacityType: (*Provider).capacityTypeLabels,
+	LabelSetArch:         (*Provider).archLabels,
+	LabelSetAMI:          (*Provider).amiLabels,
+	LabelSetInstance:     (*Provider).instanceLabels,
+	LabelSetPlacement:    (*Provider).placementLabels,
+	LabelSetTenancy:      (*Provider).tenancyLabels,
+	LabelSetNetwork:      (*Provider).networkLabels,
+}
+
+// Sets a label, as long as the value is a valid label value. Metadata
+// which does not exist for this instance is skipped silently.
+func setLabel(labels map[string]string, key, value string) {
+	if value == "" {
+		return
+	}
+
+	if errs := validation.IsValidLabelValue(value); len(errs) != 0 {
+		klog.Warningf("Not setting label %s=%s: %s", key, value, strings.Join(errs, ", "))
+		return
+	}
+
+	labels[key] = value
+}
+
+// Returns true if the given label set is enabled in the user data
+func (p *Provider) labelSetEnabled(name string) bool {
+	for _, enabled := range p.config.Node.LabelSets {
+		if enabled == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Adds the labels for each of the label sets enabled in the user data
+func (p *Provider) addLabelSets(labels map[string]string) {
+	for _, name := range p.config.Node.LabelSets {
+		generate, ok := labelSets[name]
+		if !ok {
+			klog.Warningf("Unknown label set %s. Ignoring", name)
+			continue
+		}
+
+		generate(p, labels)
+	}
+}
+
+func (p *Provider) zoneIDLabels(labels map[string]string) {
+	zoneID, _ := p.imds.GetString("meta-data/placement/availability-zone-id")
+	setLabel(labels, LabelZoneID, zoneID)
+}
+
+func (p *Provider) capacityTypeLabels(labels map[string]string) {
+	lifecycle, err := p.imds.GetString("meta-data/instance-life-cycle")
+	if err != nil {
+		klog.Warningf("Could not determine instance lifecycle: %s", err)
+		return
+	}
+
+	if lifecycle == "spot" {
+		setLabel(labels, LabelCapacityType, "spot")
+		setLabel(labels, LabelEKSCapacityType, "SPOT")
+	} else {
+		setLabel(labels, LabelCapacityType, "on-demand")
+		setLabel(labels, LabelEKSCapacityType, "ON_DEMAND")
+	}
+}
+
+// The identity document uses the kernel's names for architectures,
+// whereas Kubernetes uses Go's.
+var kubernetesArch = map[string]string{
+	"x86_64": "amd64",
+	"arm64":  "arm64",
+	"i386":   "386",
+}
+
+func (p *Provider) archLabels(labels map[string]string) {
+	doc, err := p.imds.GetIdentityDocument()
+	if err != nil {
+		klog.Warningf("Could not determine architecture: %s", err)
+		return
+	}
+
+	setLabel(labels, v1.LabelArchStable, kubernetesArch[doc.Architecture])
+}
+
+func (p *Provider) amiLabels(labels map[string]string) {
+	amiID, _ := p.imds.GetString("meta-data/ami-id")
+	setLabel(labels, LabelAMIID, amiID)
+}
+
+func (p *Provider) instanceLabels(labels map[string]string) {
+	instanceType, _ := p.imds.GetString("meta-data/instance-type")
+	family, size := splitInstanceType(instanceType)
+	category := familyClass(family)
+
+	// The generation is the number directly following the category, eg
+	// 6 for m6i or 2 for inf2
+	generation := strings.TrimPrefix(family, category)
+	if idx := strings.IndexFunc(generation, func(r rune) bool { return r < '0' || r > '9' }); idx != -1 {
+		generation = generation[:idx]
+	}
+
+	setLabel(labels, LabelInstanceCategory, category)
+	setLabel(labels, LabelInstanceFamily, family)
+	setLabel(labels, LabelInstanceGeneration, generation)
+	setLabel(labels, LabelInstanceSize, size)
+}
+
+func (p *Provider) placementLabels(labels map[string]string) {
+	group, _ := p.imds.GetString("meta-data/placement/group-name")
+	partition, _ := p.imds.GetString("meta-data/placement/partition-number")
+
+	setLabel(labels, LabelPlacementGroup, group)
+	setLabel(labels, LabelPlacementPartition, partition)
+}
+
+// IMDS only tells us if we are on a dedicated host; dedicated instances
+// cannot be told apart from default tenancy ones, so we only set the
+// tenancy label for hosts.
+func (p *Provider) tenancyLabels(labels map[string]string) {
+	hostID, err := p.imds.GetString("meta-data/placement/host-id")
+	if err != nil {
+		return
+	}
+
+	setLabel(labels, LabelTenancy, "host")
+	setLabel(labels, LabelHostID, hostID)
+}
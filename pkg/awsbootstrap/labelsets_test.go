@@ -0,0 +1,134 @@
+package awsbootstrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabelSets(t *testing.T) {
+	imds := map[string]string{
+		"meta-data/placement/availability-zone-id": "euw1-az1",
+		"meta-data/instance-life-cycle":            "on-demand",
+		"dynamic/instance-identity/document":       `{"architecture": "arm64"}`,
+		"meta-data/ami-id":                         "ami-0123456789abcdef0",
+		"meta-data/instance-type":                  "m6gd.2xlarge",
+		"meta-data/placement/group-name":           "cluster",
+		"meta-data/placement/partition-number":     "2",
+		"meta-data/placement/host-id":              "h-0123456789abcdef0",
+	}
+
+	tests := []struct {
+		name string
+		imds map[string]string
+		want map[string]string
+	}{
+		{
+			name: LabelSetZoneID,
+			imds: imds,
+			want: map[string]string{LabelZoneID: "euw1-az1"},
+		},
+		{
+			name: LabelSetCapacityType,
+			imds: imds,
+			want: map[string]string{LabelCapacityType: "on-demand", LabelEKSCapacityType: "ON_DEMAND"},
+		},
+		{
+			name: LabelSetCapacityType,
+			imds: map[string]string{"meta-data/instance-life-cycle": "spot"},
+			want: map[string]string{LabelCapacityType: "spot", LabelEKSCapacityType: "SPOT"},
+		},
+		{
+			name: LabelSetArch,
+			imds: imds,
+			want: map[string]string{"kubernetes.io/arch": "arm64"},
+		},
+		{
+			name: LabelSetArch,
+			imds: map[string]string{"dynamic/instance-identity/document": `{"architecture": "x86_64"}`},
+			want: map[string]string{"kubernetes.io/arch": "amd64"},
+		},
+		{
+			name: LabelSetAMI,
+			imds: imds,
+			want: map[string]string{LabelAMIID: "ami-0123456789abcdef0"},
+		},
+		{
+			name: LabelSetInstance,
+			imds: imds,
+			want: map[string]string{
+				LabelInstanceCategory:   "m",
+				LabelInstanceFamily:     "m6gd",
+				LabelInstanceGeneration: "6",
+				LabelInstanceSize:       "2xlarge",
+			},
+		},
+		{
+			name: LabelSetInstance,
+			imds: map[string]string{"meta-data/instance-type": "inf2.xlarge"},
+			want: map[string]string{
+				LabelInstanceCategory:   "inf",
+				LabelInstanceFamily:     "inf2",
+				LabelInstanceGeneration: "2",
+				LabelInstanceSize:       "xlarge",
+			},
+		},
+		{
+			name: LabelSetPlacement,
+			imds: imds,
+			want: map[string]string{LabelPlacementGroup: "cluster", LabelPlacementPartition: "2"},
+		},
+		{
+			name: LabelSetTenancy,
+			imds: imds,
+			want: map[string]string{LabelTenancy: "host", LabelHostID: "h-0123456789abcdef0"},
+		},
+		{
+			// Metadata which does not exist for this instance is skipped
+			name: LabelSetZoneID,
+			imds: map[string]string{},
+			want: map[string]string{},
+		},
+		{
+			name: LabelSetPlacement,
+			imds: map[string]string{},
+			want: map[string]string{},
+		},
+		{
+			name: LabelSetTenancy,
+			imds: map[string]string{},
+			want: map[string]string{},
+		},
+		{
+			name: "unknown",
+			imds: imds,
+			want: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Provider{
+				imds:   fakeImds(t, test.imds),
+				config: &MetadataInformation{Node: Node{LabelSets: []string{test.name}}},
+			}
+
+			labels := make(map[string]string)
+			p.addLabelSets(labels)
+
+			if !reflect.DeepEqual(labels, test.want) {
+				t.Errorf("Labels = %v, want %v", labels, test.want)
+			}
+		})
+	}
+}
+
+func TestSetLabel(t *testing.T) {
+	labels := make(map[string]string)
+	setLabel(labels, "example.com/empty", "")
+	setLabel(labels, "example.com/invalid", "not a valid value")
+	setLabel(labels, "example.com/valid", "value")
+
+	if want := map[string]string{"example.com/valid": "value"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("Labels = %v, want %v", labels, want)
+	}
+}
@@ -0,0 +1,158 @@
+package awsbootstrap
+
+import (
+	"strings"
+	"unicode"
+
+	"k8s.io/klog/v2"
+)
+
+// Label which records where the node's max pods value was sourced from.
+// This allows cluster operators to easily find nodes whose limits have
+// been guessed rather than looked up.
+const LabelMaxPodsSource = "kios.redcoat.dev/max-pods-source"
+
+// The places that a pod limit can be sourced from, in order of
+// precedence
+const (
+	MaxPodsSourceOverride   = "override"
+	MaxPodsSourceEniMaxPods = "eni-max-pods"
+	MaxPodsSourceCatalog    = "catalog"
+	MaxPodsSourceEstimated  = "estimated"
+	MaxPodsSourceDefault    = "default"
+)
+
+// Splits an instance type into its family (eg m6i) and size (eg
+// 2xlarge) parts
+func splitInstanceType(instanceType string) (string, string) {
+	family, size, _ := strings.Cut(instanceType, ".")
+	return family, size
+}
+
+// Returns the leading letters of an instance family, which represents
+// its broad class (eg "m" for m6i, or "inf" for inf2).
+func familyClass(family string) string {
+	if idx := strings.IndexFunc(family, unicode.IsDigit); idx != -1 {
+		return family[:idx]
+	}
+
+	return family
+}
+
+// Attempts to estimate the pod limit for an instance type that we do
+// not know about. ENI and IP limits are, in practice, driven mostly by
+// instance size so we look at all known instance types of the same size
+// and take the most common limit, preferring types of the same class.
+// This is not perfect, but is a lot better than a limit of 0.
+func estimatePodLimit(instanceType string, limits map[string]int) (int, bool) {
+	family, size := splitInstanceType(instanceType)
+	if size == "" {
+		return 0, false
+	}
+	class := familyClass(family)
+
+	sameClass := map[int]int{}
+	sameSize := map[int]int{}
+	for known, limit := range limits {
+		knownFamily, knownSize := splitInstanceType(known)
+		if knownSize != size {
+			continue
+		}
+
+		sameSize[limit]++
+		if familyClass(knownFamily) == class {
+			sameClass[limit]++
+		}
+	}
+
+	if limit, ok := mostCommon(sameClass); ok {
+		return limit, true
+	}
+
+	return mostCommon(sameSize)
+}
+
+// Returns the value with the highest count. Ties are broken by picking
+// the lowest value, so that estimates err on the side of caution.
+func mostCommon(counts map[int]int) (int, bool) {
+	best, bestCount := 0, 0
+	for value, count := range counts {
+		if count > bestCount || (count == bestCount && value < best) {
+			best, bestCount = value, count
+		}
+	}
+
+	return best, bestCount > 0
+}
+
+// Looks up the number of pod IPs available to the given instance type,
+// along with where that number came from. User provided overrides
+// always win, then any loaded eni-max-pods.txt entries, then the
+// compiled in PodLimits, then an estimate. If no
+// estimate can be made, MaxPodsSourceDefault is returned and the caller
+// should leave the kubelet's default in place.
+func (l Limits) Lookup(instanceType string) (int, string) {
+	if limit, ok := l.Overrides[instanceType]; ok {
+		return limit, MaxPodsSourceOverride
+	}
+
+	if limit, ok := l.eniMaxPods[instanceType]; ok {
+		return limit, MaxPodsSourceEniMaxPods
+	}
+
+	if limit, ok := PodLimits[instanceType]; ok {
+		return limit, MaxPodsSourceCatalog
+	}
+
+	if limit, ok := estimatePodLimit(instanceType, PodLimits); ok {
+		return limit, MaxPodsSourceEstimated
+	}
+
+	return 0, MaxPodsSourceDefault
+}
+
+// Works out the MaxPods value for this node, along with its source. If
+// the source is MaxPodsSourceDefault, no value should be set. The result
+// is cached as it is needed both when generating labels and the kubelet
+// configuration.
+func (p *Provider) maxPods() (int32, string) {
+	if p.maxPodsSource != "" {
+		return p.maxPodsValue, p.maxPodsSource
+	}
+
+	instanceType, _ := p.imds.GetString("meta-data/instance-type")
+	limit, source := p.config.Node.MaxPods.Lookup(instanceType)
+
+	switch source {
+	case MaxPodsSourceEstimated:
+		klog.Warningf("Instance type %s is not in the pod limits catalog. Estimated its limit as %d pods", instanceType, limit)
+	case MaxPodsSourceDefault:
+		klog.Errorf(
+			"Instance type %s is not in the pod limits catalog and no estimate could be made. "+
+				"MaxPods will be left as the kubelet default, which may exceed the number of pod IPs available. "+
+				"Add an entry to maxPods.overrides in the user data to fix this",
+			instanceType,
+		)
+	default:
+		klog.Infof("Using %s pod limit for %s: %d pods", source, instanceType, limit)
+	}
+
+	// The trunk ENI takes up one of the instance's interfaces, so the
+	// pod IPs that interface would have provided (all but its primary IP)
+	// are not available. This is taken from the instance type's ENI
+	// limits. Overrides are taken as the final limit, so are left alone.
+	if trunk, ok := p.podENI(); ok && source != MaxPodsSourceDefault && source != MaxPodsSourceOverride {
+		reduction := trunk.IPv4PerInterface - 1
+		if reduction > limit {
+			klog.Warningf("Pod limit of %d is less than the %d IPs the trunk ENI takes up", limit, reduction)
+			reduction = limit
+		}
+		limit -= reduction
+		klog.Infof("Reducing pod limit by %d for the trunk ENI", reduction)
+	}
+
+	p.maxPodsValue = int32(limit + p.config.Node.MaxPods.Offset)
+	p.maxPodsSource = source
+
+	return p.maxPodsValue, p.maxPodsSource
+}
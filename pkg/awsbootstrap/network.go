@@ -0,0 +1,172 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// The kubelet's node IPs are set with its --node-ip flag, not in its
+// configuration file, so, like the node labels, we write them to a file
+// which kiOS reads when it starts the kubelet. This holds the flag's
+// value: an IP, or an IPv4,IPv6 pair for dual stack nodes.
+var NodeIPPath = "/etc/kubernetes/node-ip"
+
+// An ENI attached to the instance, as described by IMDS
+type NetworkInterface struct {
+	MAC              string
+	DeviceNumber     int
+	IPv4s            []string
+	IPv6s            []string
+	VPCID            string
+	SubnetID         string
+	SecurityGroupIDs []string
+}
+
+// Loads a newline separated list from IMDS. Lists which do not exist
+// (eg ipv6s on an interface with no IPv6 addresses) are returned empty.
+func (s *ImdsSession) getList(path string) []string {
+	raw, err := s.GetString(path)
+	if err != nil {
+		return nil
+	}
+
+	return strings.Fields(raw)
+}
+
+// Loads the details of the interface with the given MAC address
+func (s *ImdsSession) getInterface(mac string) (*NetworkInterface, error) {
+	base := "meta-data/network/interfaces/macs/" + mac + "/"
+
+	deviceNumber, err := s.GetString(base + "device-number")
+	if err != nil {
+		return nil, fmt.Errorf("Could not load device number for %s: %s", mac, err)
+	}
+
+	number, err := strconv.Atoi(strings.TrimSpace(deviceNumber))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid device number for %s: %s", mac, err)
+	}
+
+	vpcID, _ := s.GetString(base + "vpc-id")
+	subnetID, _ := s.GetString(base + "subnet-id")
+
+	return &NetworkInterface{
+		MAC:              mac,
+		DeviceNumber:     number,
+		IPv4s:            s.getList(base + "local-ipv4s"),
+		IPv6s:            s.getList(base + "ipv6s"),
+		VPCID:            vpcID,
+		SubnetID:         subnetID,
+		SecurityGroupIDs: s.getList(base + "security-group-ids"),
+	}, nil
+}
+
+// Finds the instance's primary ENI, which is the one with device number
+// 0. Instances with several network cards have a device 0 on each, in
+// which case we prefer the one IMDS reports as the instance's MAC.
+func (p *Provider) primaryInterface() (*NetworkInterface, error) {
+	if p.primaryENI != nil {
+		return p.primaryENI, nil
+	}
+
+	mac, _ := p.imds.GetString("meta-data/mac")
+
+	var primary *NetworkInterface
+	for _, candidate := range p.imds.getList("meta-data/network/interfaces/macs/") {
+		iface, err := p.imds.getInterface(strings.TrimSuffix(candidate, "/"))
+		if err != nil {
+			klog.Warning(err.Error())
+			continue
+		}
+
+		if iface.DeviceNumber == 0 && (primary == nil || iface.MAC == mac) {
+			primary = iface
+		}
+	}
+
+	if primary == nil {
+		return nil, fmt.Errorf("Could not find an interface with device number 0")
+	}
+
+	klog.Infof("Using %s as the primary interface", primary.MAC)
+	p.primaryENI = primary
+
+	return primary, nil
+}
+
+// Returns the IPs the node should register with: the primary IPv4 and
+// IPv6 addresses of the primary ENI. If it has both, the node is dual
+// stack.
+func (p *Provider) nodeIPs() ([]string, error) {
+	iface, err := p.primaryInterface()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []string
+	if len(iface.IPv4s) != 0 {
+		ips = append(ips, iface.IPv4s[0])
+	}
+	if len(iface.IPv6s) != 0 {
+		ips = append(ips, iface.IPv6s[0])
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("Primary interface %s has no IP addresses", iface.MAC)
+	}
+
+	return ips, nil
+}
+
+// Saves the node's IPs so that the kubelet does not have to guess them,
+// which it can get wrong on instances with several ENIs or with
+// addresses added by DHCPv6
+func (p *Provider) saveNodeIPs() {
+	ips, err := p.nodeIPs()
+	if err != nil {
+		klog.Errorf("Could not determine node IPs, leaving the kubelet to choose: %s", err)
+		return
+	}
+
+	if err := os.WriteFile(NodeIPPath, []byte(strings.Join(ips, ",")), 0644); err != nil {
+		klog.Errorf("Could not write node IPs: %s", err)
+		return
+	}
+
+	klog.Infof("Using node IPs: %v", ips)
+}
+
+// Labels and annotations describing where the node sits in the VPC.
+// These come from the same primary ENI that the node IP is taken from.
+const (
+	LabelVPCID                 = "topology.kios.aws/vpc-id"
+	LabelSubnetID              = "topology.kios.aws/subnet-id"
+	AnnotationSecurityGroupIDs = "topology.kios.aws/security-group-ids"
+)
+
+func (p *Provider) networkLabels(labels map[string]string) {
+	iface, err := p.primaryInterface()
+	if err != nil {
+		klog.Warningf("Could not determine network labels: %s", err)
+		return
+	}
+
+	setLabel(labels, LabelVPCID, iface.VPCID)
+	setLabel(labels, LabelSubnetID, iface.SubnetID)
+}
+
+// Security group lists can easily be too long for a label value, so
+// these are an annotation instead
+func (p *Provider) networkAnnotations(annotations map[string]string) {
+	iface, err := p.primaryInterface()
+	if err != nil {
+		klog.Warningf("Could not determine network annotations: %s", err)
+		return
+	}
+
+	setAnnotation(annotations, AnnotationSecurityGroupIDs, strings.Join(iface.SecurityGroupIDs, ","))
+}
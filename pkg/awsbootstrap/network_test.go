@@ -0,0 +1,158 @@
+package awsbootstrap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNodeIPs(t *testing.T) {
+	macs := "meta-data/network/interfaces/macs/"
+	p := &Provider{imds: fakeImds(t, map[string]string{
+		"meta-data/mac": "0a:00:00:00:00:02",
+		macs:            "0a:00:00:00:00:01/\n0a:00:00:00:00:02/\n0a:00:00:00:00:03/",
+
+		// A secondary ENI
+		macs + "0a:00:00:00:00:01/device-number": "1",
+		macs + "0a:00:00:00:00:01/local-ipv4s":   "10.0.1.5",
+
+		macs + "0a:00:00:00:00:02/device-number": "0",
+		macs + "0a:00:00:00:00:02/local-ipv4s":   "10.0.0.5\n10.0.0.6",
+		macs + "0a:00:00:00:00:02/ipv6s":         "2001:db8::5",
+
+		// Device 0 on another network card
+		macs + "0a:00:00:00:00:03/device-number": "0",
+		macs + "0a:00:00:00:00:03/local-ipv4s":   "10.0.2.5",
+	})}
+
+	ips, err := p.nodeIPs()
+	if err != nil || len(ips) != 2 || ips[0] != "10.0.0.5" || ips[1] != "2001:db8::5" {
+		t.Errorf("nodeIPs() = %v, %v, want [10.0.0.5 2001:db8::5]", ips, err)
+	}
+}
+
+func TestSaveNodeIPs(t *testing.T) {
+	macs := "meta-data/network/interfaces/macs/"
+	tests := []struct {
+		name string
+		imds map[string]string
+		want string
+	}{
+		{
+			name: "IPv4",
+			imds: map[string]string{
+				macs:                                     "0a:00:00:00:00:01/",
+				macs + "0a:00:00:00:00:01/device-number": "0",
+				macs + "0a:00:00:00:00:01/local-ipv4s":   "10.0.0.5",
+			},
+			want: "10.0.0.5",
+		},
+		{
+			name: "dual stack",
+			imds: map[string]string{
+				macs:                                     "0a:00:00:00:00:01/",
+				macs + "0a:00:00:00:00:01/device-number": "0",
+				macs + "0a:00:00:00:00:01/local-ipv4s":   "10.0.0.5",
+				macs + "0a:00:00:00:00:01/ipv6s":         "2001:db8::5\n2001:db8::6",
+			},
+			want: "10.0.0.5,2001:db8::5",
+		},
+		{
+			name: "IPv6",
+			imds: map[string]string{
+				macs:                                     "0a:00:00:00:00:01/",
+				macs + "0a:00:00:00:00:01/device-number": "0",
+				macs + "0a:00:00:00:00:01/ipv6s":         "2001:db8::5",
+			},
+			want: "2001:db8::5",
+		},
+		{
+			// The kubelet is left to choose
+			name: "no addresses",
+			imds: map[string]string{
+				macs:                                     "0a:00:00:00:00:01/",
+				macs + "0a:00:00:00:00:01/device-number": "0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			NodeIPPath = filepath.Join(t.TempDir(), "node-ip")
+			p := &Provider{imds: fakeImds(t, test.imds)}
+			p.saveNodeIPs()
+
+			got, err := os.ReadFile(NodeIPPath)
+			if test.want == "" {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("Node IP file was written with %q", got)
+				}
+			} else if string(got) != test.want {
+				t.Errorf("Node IP file = %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestNetworkLabels(t *testing.T) {
+	macs := "meta-data/network/interfaces/macs/"
+	tests := []struct {
+		name            string
+		imds            map[string]string
+		wantLabels      map[string]string
+		wantAnnotations map[string]string
+	}{
+		{
+			name: "primary interface",
+			imds: map[string]string{
+				macs:                                          "0a:00:00:00:00:01/\n0a:00:00:00:00:02/",
+				macs + "0a:00:00:00:00:01/device-number":      "1",
+				macs + "0a:00:00:00:00:01/vpc-id":             "vpc-other",
+				macs + "0a:00:00:00:00:02/device-number":      "0",
+				macs + "0a:00:00:00:00:02/vpc-id":             "vpc-0123456789abcdef0",
+				macs + "0a:00:00:00:00:02/subnet-id":          "subnet-0123456789abcdef0",
+				macs + "0a:00:00:00:00:02/security-group-ids": "sg-01\nsg-02",
+			},
+			wantLabels: map[string]string{
+				LabelVPCID:    "vpc-0123456789abcdef0",
+				LabelSubnetID: "subnet-0123456789abcdef0",
+			},
+			wantAnnotations: map[string]string{AnnotationSecurityGroupIDs: "sg-01,sg-02"},
+		},
+		{
+			name: "missing metadata",
+			imds: map[string]string{
+				macs:                                     "0a:00:00:00:00:01/",
+				macs + "0a:00:00:00:00:01/device-number": "0",
+			},
+			wantLabels:      map[string]string{},
+			wantAnnotations: map[string]string{},
+		},
+		{
+			name:            "no primary interface",
+			imds:            map[string]string{},
+			wantLabels:      map[string]string{},
+			wantAnnotations: map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Provider{imds: fakeImds(t, test.imds)}
+
+			labels := make(map[string]string)
+			p.networkLabels(labels)
+			if !reflect.DeepEqual(labels, test.wantLabels) {
+				t.Errorf("networkLabels() = %v, want %v", labels, test.wantLabels)
+			}
+
+			annotations := make(map[string]string)
+			p.networkAnnotations(annotations)
+			if !reflect.DeepEqual(annotations, test.wantAnnotations) {
+				t.Errorf("networkAnnotations() = %v, want %v", annotations, test.wantAnnotations)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package awsbootstrap
+
+import (
+	"k8s.io/klog/v2"
+)
+
+// Labels set by EKS managed node groups
+const (
+	LabelEKSNodeGroup      = "eks.amazonaws.com/nodegroup"
+	LabelEKSNodeGroupImage = "eks.amazonaws.com/nodegroup-image"
+)
+
+// Instance tags which identify the node group an instance belongs to
+const (
+	TagEKSNodeGroupName = "eks:nodegroup-name"
+	TagAutoScalingGroup = "aws:autoscaling:groupName"
+)
+
+// Cluster Autoscaler reads these ASG tags to work out which labels and
+// taints nodes will have when scaling a group up from zero. ASGs
+// propagate their tags to their instances, so in node group
+// compatibility mode we apply them to the node too.
+const (
+	TagPrefixClusterAutoscalerLabel = "k8s.io/cluster-autoscaler/node-template/label/"
+	TagPrefixClusterAutoscalerTaint = "k8s.io/cluster-autoscaler/node-template/taint/"
+)
+
+// Returns the tag mapping to use, which includes the Cluster Autoscaler
+// node template prefixes in node group compatibility mode
+func (p *Provider) tagMapping() TagMapping {
+	mapping := p.config.Node.TagMapping
+	if p.config.Node.NodeGroupCompatibility {
+		mapping.LabelPrefixes = append(mapping.LabelPrefixes, TagPrefixClusterAutoscalerLabel)
+		mapping.TaintPrefixes = append(mapping.TaintPrefixes, TagPrefixClusterAutoscalerTaint)
+	}
+
+	return mapping
+}
+
+// Adds the labels that an EKS managed node group would have added, so
+// that workloads selecting on them can run on kiOS nodes
+func (p *Provider) nodeGroupLabels(labels map[string]string) {
+	if !p.config.Node.NodeGroupCompatibility {
+		return
+	}
+
+	amiID, _ := p.imds.GetString("meta-data/ami-id")
+	setLabel(labels, LabelEKSNodeGroupImage, amiID)
+	p.capacityTypeLabels(labels)
+
+	tags, err := p.instanceTags()
+	if err != nil {
+		klog.Errorf("Cannot determine node group: %s", err)
+		return
+	}
+
+	// Managed node groups are tagged with their name. For self managed
+	// groups, the ASG name is the closest equivalent.
+	nodeGroup := tags[TagEKSNodeGroupName]
+	if nodeGroup == "" {
+		nodeGroup = tags[TagAutoScalingGroup]
+	}
+
+	if nodeGroup == "" {
+		klog.Warning("Instance is not part of an Auto Scaling Group. Not setting node group label")
+	} else {
+		setLabel(labels, LabelEKSNodeGroup, nodeGroup)
+	}
+}
@@ -0,0 +1,128 @@
+package awsbootstrap
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestNodeGroupLabels(t *testing.T) {
+	tests := []struct {
+		name          string
+		compatibility bool
+		tags          map[string]string
+		want          map[string]string
+	}{
+		{
+			name: "compatibility off",
+			tags: map[string]string{TagEKSNodeGroupName: "workers"},
+			want: map[string]string{},
+		},
+		{
+			name:          "managed node group",
+			compatibility: true,
+			tags:          map[string]string{TagEKSNodeGroupName: "workers", TagAutoScalingGroup: "eks-workers-0123"},
+			want: map[string]string{
+				LabelEKSNodeGroup:      "workers",
+				LabelEKSNodeGroupImage: "ami-0123456789abcdef0",
+				LabelCapacityType:      "spot",
+				LabelEKSCapacityType:   "SPOT",
+			},
+		},
+		{
+			name:          "self managed group falls back to the ASG name",
+			compatibility: true,
+			tags:          map[string]string{TagAutoScalingGroup: "workers-asg"},
+			want: map[string]string{
+				LabelEKSNodeGroup:      "workers-asg",
+				LabelEKSNodeGroupImage: "ami-0123456789abcdef0",
+				LabelCapacityType:      "spot",
+				LabelEKSCapacityType:   "SPOT",
+			},
+		},
+		{
+			name:          "not in a group",
+			compatibility: true,
+			tags:          map[string]string{"Name": "worker"},
+			want: map[string]string{
+				LabelEKSNodeGroupImage: "ami-0123456789abcdef0",
+				LabelCapacityType:      "spot",
+				LabelEKSCapacityType:   "SPOT",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Provider{
+				imds: fakeImds(t, map[string]string{
+					"meta-data/ami-id":              "ami-0123456789abcdef0",
+					"meta-data/instance-life-cycle": "spot",
+				}),
+				config: &MetadataInformation{Node: Node{NodeGroupCompatibility: test.compatibility}},
+				tags:   test.tags,
+			}
+
+			labels := make(map[string]string)
+			p.nodeGroupLabels(labels)
+
+			if !reflect.DeepEqual(labels, test.want) {
+				t.Errorf("nodeGroupLabels() = %v, want %v", labels, test.want)
+			}
+		})
+	}
+}
+
+func TestNodeTemplateTags(t *testing.T) {
+	tags := map[string]string{
+		TagPrefixClusterAutoscalerLabel + "team":      "platform",
+		TagPrefixClusterAutoscalerTaint + "dedicated": "gpu:NoSchedule",
+		"example.com/label/zone":                      "a",
+	}
+
+	tests := []struct {
+		name          string
+		compatibility bool
+		mapping       TagMapping
+		wantLabels    map[string]string
+		wantTaints    []v1.Taint
+	}{
+		{
+			name:       "compatibility off",
+			wantLabels: map[string]string{},
+		},
+		{
+			name:          "compatibility on",
+			compatibility: true,
+			wantLabels:    map[string]string{"team": "platform"},
+			wantTaints:    []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}},
+		},
+		{
+			name:          "alongside the user's prefixes",
+			compatibility: true,
+			mapping:       TagMapping{LabelPrefixes: []string{"example.com/label/"}},
+			wantLabels:    map[string]string{"team": "platform", "zone": "a"},
+			wantTaints:    []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Provider{
+				config: &MetadataInformation{Node: Node{
+					NodeGroupCompatibility: test.compatibility,
+					TagMapping:             test.mapping,
+				}},
+				tags: tags,
+			}
+
+			if labels := p.tagLabels(); !reflect.DeepEqual(labels, test.wantLabels) {
+				t.Errorf("tagLabels() = %v, want %v", labels, test.wantLabels)
+			}
+			if taints := p.tagTaints(); !reflect.DeepEqual(taints, test.wantTaints) {
+				t.Errorf("tagTaints() = %v, want %v", taints, test.wantTaints)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// An AWS partition: a separate copy of AWS, with its own regions, IAM
+// and domain names
+type Partition struct {
+	ID string
+
+	// The domain AWS service endpoints in this partition are under
+	DNSSuffix string
+
+	// Regions are in this partition if their names start with any of
+	// these. The aws partition has none, and is used for any region
+	// which does not match another partition.
+	RegionPrefixes []string
+
+	// The regions in this partition which have FIPS endpoints
+	FIPSRegions []string
+}
+
+var Partitions = []Partition{
+	{ID: "aws-cn", DNSSuffix: "amazonaws.com.cn", RegionPrefixes: []string{"cn-"}},
+	{
+		ID:             "aws-us-gov",
+		DNSSuffix:      "amazonaws.com",
+		RegionPrefixes: []string{"us-gov-"},
+		FIPSRegions:    []string{"us-gov-east-1", "us-gov-west-1"},
+	},
+	{ID: "aws-iso", DNSSuffix: "c2s.ic.gov", RegionPrefixes: []string{"us-iso-"}},
+	{ID: "aws-iso-b", DNSSuffix: "sc2s.sgov.gov", RegionPrefixes: []string{"us-isob-"}},
+	{ID: "aws-iso-e", DNSSuffix: "cloud.adc-e.uk", RegionPrefixes: []string{"eu-isoe-"}},
+	{ID: "aws-iso-f", DNSSuffix: "csp.hci.ic.gov", RegionPrefixes: []string{"us-isof-"}},
+	{
+		ID:          "aws",
+		DNSSuffix:   "amazonaws.com",
+		FIPSRegions: []string{"us-east-1", "us-east-2", "us-west-1", "us-west-2", "ca-central-1", "ca-west-1"},
+	},
+}
+
+// Resolves the endpoints and names of things in AWS for a region
+type Resolver struct {
+	Region    string
+	Partition Partition
+
+	// Use FIPS endpoints for AWS services
+	FIPS bool
+}
+
+// Returns the partition the given region is in
+func regionPartition(region string) Partition {
+	for _, partition := range Partitions {
+		for _, prefix := range partition.RegionPrefixes {
+			if strings.HasPrefix(region, prefix) {
+				return partition
+			}
+		}
+	}
+
+	return Partitions[len(Partitions)-1]
+}
+
+// Returns true if the partition has FIPS endpoints in the given region
+func (p Partition) hasFIPS(region string) bool {
+	for _, fipsRegion := range p.FIPSRegions {
+		if fipsRegion == region {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Creates a resolver for the given region. Asking for FIPS endpoints in
+// a region which has none is an error: their hostnames would not exist,
+// and quietly using the standard ones instead would not be FIPS.
+func NewResolver(region string, fips bool) (*Resolver, error) {
+	partition := regionPartition(region)
+	if fips && !partition.hasFIPS(region) {
+		return nil, fmt.Errorf("FIPS endpoints were requested, but region %q has none", region)
+	}
+
+	return &Resolver{
+		Region:    region,
+		Partition: partition,
+		FIPS:      fips,
+	}, nil
+}
+
+// Services whose endpoints are not named after the service itself.
+// Their FIPS endpoints are, however.
+var serviceHostnames = map[string]string{
+	"ecr": "api.ecr",
+}
+
+// Returns the regional endpoint for the given service
+func (r *Resolver) Endpoint(service string) string {
+	host := service
+	if r.FIPS {
+		host += "-fips"
+	} else if name, ok := serviceHostnames[service]; ok {
+		host = name
+	}
+
+	return fmt.Sprintf("https://%s.%s.%s", host, r.Region, r.Partition.DNSSuffix)
+}
+
+// Returns the domain that EC2 private DNS names are in. us-east-1
+// predates the regional naming scheme, so is special.
+func (r *Resolver) PrivateDNSDomain() string {
+	if r.Region == "us-east-1" {
+		return "ec2.internal"
+	}
+
+	return r.Region + ".compute.internal"
+}
+
+// Returns the image patterns which match ECR registries in this
+// partition. Only the partition's own registries are matched, as the
+// node's credentials are not valid in any other.
+func (r *Resolver) ECRPatterns() []string {
+	patterns := []string{"*.dkr.ecr.*." + r.Partition.DNSSuffix}
+	if len(r.Partition.FIPSRegions) != 0 {
+		patterns = append(patterns, "*.dkr.ecr-fips.*."+r.Partition.DNSSuffix)
+	}
+
+	return patterns
+}
+
+// Returns the resolver for the node's region, taken from the instance
+// identity document
+func (p *Provider) resolver() *Resolver {
+	if p.endpoints != nil {
+		return p.endpoints
+	}
+
+	region := ""
+	if doc, err := p.imds.GetIdentityDocument(); err != nil {
+		klog.Warningf("Could not load identity document, falling back to placement region: %s", err)
+		region, _ = p.imds.GetString("meta-data/placement/region")
+	} else {
+		region = doc.Region
+	}
+
+	endpoints, err := NewResolver(region, p.config.Node.FIPS)
+	if err != nil {
+		fatalf("Cannot use FIPS mode: %s", err)
+	}
+	p.endpoints = endpoints
+	klog.Infof("Region %s is in the %s partition (FIPS: %t)", region, p.endpoints.Partition.ID, p.endpoints.FIPS)
+
+	return p.endpoints
+}
@@ -0,0 +1,122 @@
+package awsbootstrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A resolver for a commercial region, without FIPS
+var testResolver = &Resolver{Region: "eu-west-1", Partition: regionPartition("eu-west-1")}
+
+func TestNewResolver(t *testing.T) {
+	tests := []struct {
+		region    string
+		fips      bool
+		partition string
+		wantErr   bool
+	}{
+		{region: "eu-west-1", partition: "aws"},
+		{region: "us-east-1", partition: "aws"},
+		{region: "us-east-1", fips: true, partition: "aws"},
+		{region: "ca-central-1", fips: true, partition: "aws"},
+		{region: "eu-west-1", fips: true, wantErr: true},
+		{region: "ap-southeast-2", fips: true, wantErr: true},
+		{region: "cn-north-1", partition: "aws-cn"},
+		{region: "cn-northwest-1", fips: true, wantErr: true},
+		{region: "us-gov-west-1", partition: "aws-us-gov"},
+		{region: "us-gov-east-1", fips: true, partition: "aws-us-gov"},
+		{region: "us-iso-east-1", partition: "aws-iso"},
+		{region: "us-iso-east-1", fips: true, wantErr: true},
+		{region: "us-isob-east-1", partition: "aws-iso-b"},
+		{region: "eu-isoe-west-1", partition: "aws-iso-e"},
+		{region: "us-isof-south-1", partition: "aws-iso-f"},
+		{region: "", fips: true, wantErr: true},
+	}
+
+	for _, test := range tests {
+		resolver, err := NewResolver(test.region, test.fips)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("NewResolver(%q, %t) returned no error", test.region, test.fips)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("NewResolver(%q, %t) returned %v", test.region, test.fips, err)
+		} else if resolver.Partition.ID != test.partition || resolver.FIPS != test.fips {
+			t.Errorf("NewResolver(%q, %t) = %s (FIPS: %t)", test.region, test.fips, resolver.Partition.ID, resolver.FIPS)
+		}
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		region  string
+		fips    bool
+		service string
+		want    string
+	}{
+		{"eu-west-1", false, "sts", "https://sts.eu-west-1.amazonaws.com"},
+		{"eu-west-1", false, "ecr", "https://api.ecr.eu-west-1.amazonaws.com"},
+		{"us-east-1", true, "sts", "https://sts-fips.us-east-1.amazonaws.com"},
+		{"us-east-1", true, "ecr", "https://ecr-fips.us-east-1.amazonaws.com"},
+		{"cn-north-1", false, "ec2", "https://ec2.cn-north-1.amazonaws.com.cn"},
+		{"cn-north-1", false, "ecr", "https://api.ecr.cn-north-1.amazonaws.com.cn"},
+		{"us-gov-west-1", false, "ssm", "https://ssm.us-gov-west-1.amazonaws.com"},
+		{"us-gov-west-1", true, "s3", "https://s3-fips.us-gov-west-1.amazonaws.com"},
+		{"us-gov-west-1", true, "ecr", "https://ecr-fips.us-gov-west-1.amazonaws.com"},
+		{"us-iso-east-1", false, "sts", "https://sts.us-iso-east-1.c2s.ic.gov"},
+		{"us-iso-east-1", false, "ecr", "https://api.ecr.us-iso-east-1.c2s.ic.gov"},
+		{"us-isob-east-1", false, "ec2", "https://ec2.us-isob-east-1.sc2s.sgov.gov"},
+		{"eu-isoe-west-1", false, "s3", "https://s3.eu-isoe-west-1.cloud.adc-e.uk"},
+		{"us-isof-south-1", false, "ecr", "https://api.ecr.us-isof-south-1.csp.hci.ic.gov"},
+	}
+
+	for _, test := range tests {
+		resolver, err := NewResolver(test.region, test.fips)
+		if err != nil {
+			t.Errorf("NewResolver(%q, %t) returned %v", test.region, test.fips, err)
+			continue
+		}
+
+		if got := resolver.Endpoint(test.service); got != test.want {
+			t.Errorf("Endpoint(%s) in %s (FIPS: %t) = %s, want %s", test.service, test.region, test.fips, got, test.want)
+		}
+	}
+}
+
+func TestECRPatterns(t *testing.T) {
+	tests := []struct {
+		region string
+		want   []string
+	}{
+		{"eu-west-1", []string{"*.dkr.ecr.*.amazonaws.com", "*.dkr.ecr-fips.*.amazonaws.com"}},
+		{"cn-north-1", []string{"*.dkr.ecr.*.amazonaws.com.cn"}},
+		{"us-gov-west-1", []string{"*.dkr.ecr.*.amazonaws.com", "*.dkr.ecr-fips.*.amazonaws.com"}},
+		{"us-iso-east-1", []string{"*.dkr.ecr.*.c2s.ic.gov"}},
+		{"us-isob-east-1", []string{"*.dkr.ecr.*.sc2s.sgov.gov"}},
+		{"eu-isoe-west-1", []string{"*.dkr.ecr.*.cloud.adc-e.uk"}},
+		{"us-isof-south-1", []string{"*.dkr.ecr.*.csp.hci.ic.gov"}},
+	}
+
+	for _, test := range tests {
+		resolver, _ := NewResolver(test.region, false)
+		if got := resolver.ECRPatterns(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ECRPatterns() in %s = %v, want %v", test.region, got, test.want)
+		}
+	}
+}
+
+func TestPrivateDNSDomain(t *testing.T) {
+	for region, want := range map[string]string{
+		"us-east-1":     "ec2.internal",
+		"eu-west-1":     "eu-west-1.compute.internal",
+		"us-gov-west-1": "us-gov-west-1.compute.internal",
+	} {
+		resolver, _ := NewResolver(region, false)
+		if got := resolver.PrivateDNSDomain(); got != want {
+			t.Errorf("PrivateDNSDomain() in %s = %s, want %s", region, got, want)
+		}
+	}
+}
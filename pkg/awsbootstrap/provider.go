@@ -1,14 +1,13 @@
 package awsbootstrap
 
 import (
-	"encoding/base64"
-	"fmt"
-	"time"
+	"os"
 
 	"github.com/EmilyShepherd/kios-go-sdk/pkg/bootstrap"
 	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
 	kubeconfig "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/klog/v2"
 	kubelet "k8s.io/kubelet/config/v1beta1"
 )
 
@@ -17,29 +16,50 @@ import (
 type Provider struct {
 	config *MetadataInformation
 	imds   *ImdsSession
+	aws    *AwsClient
+
+	maxPodsValue  int32
+	maxPodsSource string
+	trunking      *TrunkingLimit
+	tags          map[string]string
+	tagsErr       error
+	primaryENI    *NetworkInterface
+	endpoints     *Resolver
+	kubeletVer    *version.Version
+	accelerators  *Accelerator
+	caBundle      []byte
+	endpoint      string
 }
 
+// The SDK ignores the error Init returns, so failures here are fatal
+// rather than leaving the provider without its config
 func (p *Provider) Init() error {
 	imds, err := NewImdsSession(30)
 	if err != nil {
-		fmt.Errorf("Could not create IMDS Session: %s\n", err)
+		fatalf("Could not create IMDS Session: %s", err)
 	}
 	p.imds = imds
 
 	config, err := imds.GetUserData()
 	if err != nil {
-		return fmt.Errorf("Could not load User Data: %s\n", err)
+		fatalf("Could not load User Data: %s", err)
 	}
 	p.config = config
 
+	if config.Node.MaxPods.Set {
+		p.loadEniMaxPods()
+	}
+
 	return nil
 }
 
-// Returns the base64 decoded cluster CA certificate from the user data
+// Returns the cluster CA bundle from the user data. A CA which cannot
+// be used would leave the node with a kubeconfig that never works, so
+// this is fatal.
 func (p *Provider) GetClusterCA() bootstrap.Cert {
-	clusterCA, err := base64.StdEncoding.DecodeString(p.config.ApiServer.CA)
+	clusterCA, err := p.clusterCA()
 	if err != nil {
-		// fmt.Errorf("Could not decode CA certificate: %s", err)
+		fatalf("Invalid cluster CA: %s", err)
 	}
 
 	return bootstrap.Cert{
@@ -47,44 +67,34 @@ func (p *Provider) GetClusterCA() bootstrap.Cert {
 	}
 }
 
-// Returns the default settings for the ECR Credential Provider
+// Returns the ECR Credential Provider, and any others set in the user
+// data
 func (p *Provider) GetCredentialProviders() []kubelet.CredentialProvider {
-	return []kubelet.CredentialProvider{kubelet.CredentialProvider{
-		Name: "ecr-credential-provider",
-		MatchImages: []string{
-			"*.dkr.ecr.*.amazonaws.com",
-			"*.dkr.ecr.*.amazonaws.cn",
-			"*.dkr.ecr-fips.*.amazonaws.com",
-			"*.dkr.ecr.us-iso-east-1.c2s.ic.gov",
-			"*.dkr.ecr.us-isob-east-1.sc2s.sgov.gov",
-		},
-		DefaultCacheDuration: &metav1.Duration{
-			Duration: 12 * time.Hour,
-		},
-		APIVersion: "credentialprovider.kubelet.k8s.io/v1alpha1",
-		Args:       []string{"get-credentials"},
-	}}
+	return p.credentialProviders()
 }
 
 func (p *Provider) GetHostname() string {
-	// In AWS, the hostname should not be configurable. This is because we
-	// use the EC2 role to authenticate the node with the kubernetes-api.
-	// The aws-iam-authenticator setup will normally force nodes to auth
-	// as their private DNS hostname.
-	hostname, err := p.imds.GetString("meta-data/hostname")
+	// In AWS, the hostname should not normally be changed. This is
+	// because we use the EC2 role to authenticate the node with the
+	// kubernetes-api. The aws-iam-authenticator server will normally force
+	// nodes to auth as their private DNS hostname. However, some setups
+	// need something else, so this can be set by policy.
+	hostname, err := p.hostname()
 	if err != nil {
-		//return fmt.Errorf("Could not determine the AWS-provided hostname: %s", err)
+		fatalf("Could not determine the hostname: %s", err)
 	}
 
+	if err := p.validateHostname(hostname); err != nil {
+		fatalf("Invalid hostname: %s", err)
+	}
+
+	klog.Infof("Using hostname: %s", hostname)
+
 	return hostname
 }
 
 func (p *Provider) GetNodeLabels() map[string]string {
-	labels := p.config.Node.Labels
-
-	if len(labels) == 0 {
-		labels = make(map[string]string)
-	}
+	labels := p.tagLabels()
 
 	instanceType, _ := p.imds.GetString("meta-data/instance-type")
 	zone, _ := p.imds.GetString("meta-data/placement/availability-zone")
@@ -94,30 +104,92 @@ func (p *Provider) GetNodeLabels() map[string]string {
 	labels[v1.LabelTopologyZone] = zone
 	labels[v1.LabelTopologyRegion] = region
 
-	return labels
+	p.addLabelSets(labels)
+	p.nodeGroupLabels(labels)
+	p.karpenterLabels(labels)
+	p.acceleratorLabels(labels)
+
+	if p.config.Node.MaxPods.Set {
+		_, source := p.maxPods()
+		labels[LabelMaxPodsSource] = source
+	}
+
+	if _, ok := p.podENI(); ok {
+		labels[LabelHasTrunkAttached] = "false"
+	}
+
+	// Labels set explicitly in the user data always take precedence
+	for key, value := range p.config.Node.Labels {
+		if computed, ok := labels[key]; ok && computed != value {
+			klog.Warningf("Label %s=%s from user data overrides computed value %s", key, value, computed)
+		}
+		labels[key] = value
+	}
+
+	allowed, restricted := partitionLabels(validLabels(labels))
+	p.saveNodeMetadata(restricted)
+
+	return allowed
 }
 
+// Returns the API server endpoint to use, which is picked from the
+// configured ones by health checking them
 func (p *Provider) GetClusterEndpoint() string {
-	return p.config.ApiServer.Endpoint
+	endpoint, err := p.clusterEndpoint()
+	if err != nil {
+		fatalf("Could not choose an API server endpoint: %s", err)
+	}
+
+	return endpoint
 }
 
 func (p *Provider) GetClusterAuthInfo() kubeconfig.AuthInfo {
-	region, _ := p.imds.GetString("meta-data/placement/region")
+	switch mode := p.authMode(); mode {
+	case AuthModeBootstrapToken:
+		return p.bootstrapTokenAuthInfo()
+	case AuthModeIAMAuthenticator:
+	default:
+		fatalf("Unknown auth mode %s", mode)
+	}
+
+	authArgs, err := p.authArgs()
+	if err != nil {
+		fatalf("Invalid authentication settings: %s", err)
+	}
+
 	return kubeconfig.AuthInfo{
 		Exec: &kubeconfig.ExecConfig{
-			Command:    "/usr/libexec/kubernetes/kubelet-plugins/credential-provider/exec/aws-iam-authenticator",
+			Command:    bootstrap.BinaryDstDir + "aws-bootstrap",
 			APIVersion: "client.authentication.k8s.io/v1beta1",
-			Args: []string{
+			Args: append([]string{
 				"token",
-				"-i",
+				"--cluster",
 				p.config.ApiServer.Name,
 				"--region",
-				region,
-			},
+				p.resolver().Region,
+			}, authArgs...),
 		},
 	}
 }
 
 func (p *Provider) GetContainerRuntimeConfiguration() bootstrap.ContainerRuntimeConfiguration {
-	return p.config.Node.ContainerRuntime
+	config := p.config.Node.ContainerRuntime
+
+	// The SDK only restarts CRI-O if it writes a setting itself, so if
+	// we have added a runtime handler and it is not going to, we have to
+	// ask kiOS to restart CRI-O ourselves
+	if p.saveRuntimeHandler() && config.ImageVolumes == "" {
+		restartCrio()
+	}
+
+	return config
+}
+
+// Logs an error and stops the bootstrap. The SDK gives providers no way
+// of returning errors, so this is used for problems which would leave
+// the node unable to join the cluster anyway.
+func fatalf(format string, args ...interface{}) {
+	klog.Errorf(format, args...)
+	klog.Flush()
+	os.Exit(1)
 }
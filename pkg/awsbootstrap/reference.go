@@ -0,0 +1,88 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Loads the data pointed at by a reference in the user data. The
+// following forms are supported:
+//
+//	s3://bucket/path/to/key
+//	ssm:parameter-name
+//	secretsmanager:secret-id
+//	file:///path/on/the/node
+//	/path/on/the/node
+//
+// Files are read from the node's filesystem, which includes anything
+// shipped in the datapart image under /etc.
+func (p *Provider) LoadReference(ref string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(ref, "s3://"):
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(ref, "s3://"), "/")
+		if bucket == "" || key == "" {
+			return nil, fmt.Errorf("Invalid S3 reference %s: expected s3://bucket/key", ref)
+		}
+
+		client, err := p.awsClient()
+		if err != nil {
+			return nil, err
+		}
+
+		return client.GetS3Object(bucket, key)
+
+	case strings.HasPrefix(ref, "ssm:"):
+		name := strings.TrimPrefix(ref, "ssm:")
+		if name == "" {
+			return nil, fmt.Errorf("Invalid SSM reference %s: expected ssm:parameter-name", ref)
+		}
+
+		client, err := p.awsClient()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := client.GetSSMParameter(name)
+		return []byte(value), err
+
+	case strings.HasPrefix(ref, "secretsmanager:"):
+		secretID := strings.TrimPrefix(ref, "secretsmanager:")
+		if secretID == "" {
+			return nil, fmt.Errorf("Invalid Secrets Manager reference %s: expected secretsmanager:secret-id", ref)
+		}
+
+		client, err := p.awsClient()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := client.GetSecretValue(secretID)
+		return []byte(value), err
+
+	case strings.HasPrefix(ref, "file://"), strings.HasPrefix(ref, "/"):
+		data, err := os.ReadFile(strings.TrimPrefix(ref, "file://"))
+		if err != nil {
+			return nil, fmt.Errorf("Could not read %s: %s", ref, err)
+		}
+
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("Unsupported reference %s", ref)
+}
+
+// Returns an AwsClient for the node's region, creating it on first use
+func (p *Provider) awsClient() (*AwsClient, error) {
+	if p.aws != nil {
+		return p.aws, nil
+	}
+
+	client, err := NewAwsClient(p.imds, p.resolver())
+	if err != nil {
+		return nil, fmt.Errorf("Could not create AWS client: %s", err)
+	}
+	p.aws = client
+
+	return client, nil
+}
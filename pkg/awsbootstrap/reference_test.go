@@ -0,0 +1,117 @@
+package awsbootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Starts a fake AWS API, and returns a client which sends every service
+// to it
+func fakeAws(t *testing.T, handler http.HandlerFunc) *AwsClient {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	endpoints := make(map[string]string)
+	for _, service := range []string{"s3", "ssm", "secretsmanager", "sts", "ec2", "ecr"} {
+		endpoints[service] = server.URL
+	}
+
+	return &AwsClient{
+		Region:      "eu-west-1",
+		Resolver:    testResolver,
+		Credentials: &Credentials{AccessKeyId: "AKIDEXAMPLE", SecretAccessKey: "secret"},
+		HTTPClient:  server.Client(),
+		Endpoints:   endpoints,
+	}
+}
+
+// Serves S3 objects, SSM parameters and secrets from the given map,
+// keyed by the reference which should load them
+func fakeReferences(values map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var key string
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSSM.GetParameter":
+			var input struct{ Name string }
+			json.NewDecoder(r.Body).Decode(&input)
+			if value, ok := values["ssm:"+input.Name]; ok {
+				json.NewEncoder(w).Encode(map[string]interface{}{"Parameter": map[string]string{"Value": value}})
+				return
+			}
+		case "secretsmanager.GetSecretValue":
+			var input struct{ SecretId string }
+			json.NewDecoder(r.Body).Decode(&input)
+			if value, ok := values["secretsmanager:"+input.SecretId]; ok {
+				json.NewEncoder(w).Encode(map[string]string{"SecretString": value})
+				return
+			}
+		case "":
+			key = "s3:/" + r.URL.Path
+			if value, ok := values[key]; ok {
+				w.Write([]byte(value))
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestLoadReference(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "eni-max-pods.txt")
+	if err := os.WriteFile(path, []byte("from a file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := Provider{aws: fakeAws(t, fakeReferences(map[string]string{
+		"s3://bucket/path/to/key":   "from s3",
+		"ssm:/kios/parameter":       "from ssm",
+		"secretsmanager:kios-token": "from secrets manager",
+	}))}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "s3://bucket/path/to/key", want: "from s3"},
+		{ref: "ssm:/kios/parameter", want: "from ssm"},
+		{ref: "secretsmanager:kios-token", want: "from secrets manager"},
+		{ref: path, want: "from a file"},
+		{ref: "file://" + path, want: "from a file"},
+		{ref: "s3://bucket/missing", wantErr: true},
+		{ref: "s3://bucket", wantErr: true},
+		{ref: "s3:///key", wantErr: true},
+		{ref: "ssm:", wantErr: true},
+		{ref: "secretsmanager:", wantErr: true},
+		{ref: filepath.Join(dir, "missing"), wantErr: true},
+		{ref: "https://example.com/eni-max-pods.txt", wantErr: true},
+		{ref: "relative/path", wantErr: true},
+		{ref: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := p.LoadReference(test.ref)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("LoadReference(%q) = %q, want an error", test.ref, got)
+			}
+		} else if err != nil || string(got) != test.want {
+			t.Errorf("LoadReference(%q) = %q, %v, want %q", test.ref, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package awsbootstrap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returns the shared config profile named in the environment, if any.
+// As with the AWS SDKs, AWS_PROFILE takes precedence.
+func SharedConfigProfile() string {
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+
+	return os.Getenv("AWS_DEFAULT_PROFILE")
+}
+
+// Returns the path to a shared config file, from the given environment
+// variable or in ~/.aws
+func sharedConfigPath(env, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".aws", name)
+}
+
+// Parses a shared config or credentials file into its sections. In the
+// config file, sections other than the default are named "profile
+// <name>", so that prefix is removed. Files which do not exist are
+// treated as empty.
+func parseSharedConfigFile(path string, config bool) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+	if path == "" {
+		return sections, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sections, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var section map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if config && name != "default" {
+				name = strings.TrimSpace(strings.TrimPrefix(name, "profile "))
+			}
+
+			if sections[name] == nil {
+				sections[name] = make(map[string]string)
+			}
+			section = sections[name]
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section == nil {
+			continue
+		}
+		section[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return sections, scanner.Err()
+}
+
+// Loads the settings for the named profile from the shared config and
+// credentials files. Settings in the credentials file take precedence.
+func loadSharedProfile(name string) (map[string]string, error) {
+	profile := make(map[string]string)
+	found := false
+
+	for _, file := range []struct {
+		path   string
+		config bool
+	}{
+		{sharedConfigPath("AWS_CONFIG_FILE", "config"), true},
+		{sharedConfigPath("AWS_SHARED_CREDENTIALS_FILE", "credentials"), false},
+	} {
+		sections, err := parseSharedConfigFile(file.path, file.config)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read %s: %s", file.path, err)
+		}
+
+		if section, ok := sections[name]; ok {
+			found = true
+			for key, value := range section {
+				profile[key] = value
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Profile %s is not in the shared config or credentials files", name)
+	}
+
+	return profile, nil
+}
+
+// Loads credentials for a profile in the shared config and credentials
+// files. Profiles with static keys use them. Profiles with a role_arn
+// have it assumed, using credentials from their source_profile or
+// credential_source, with the given client (whose credentials are
+// replaced). The IMDS session is only used for a credential_source of
+// Ec2InstanceMetadata, so is created on demand.
+func ProfileCredentials(name string, client *AwsClient, imds func() (*ImdsSession, error)) (*Credentials, error) {
+	return profileCredentials(name, client, imds, map[string]bool{})
+}
+
+func profileCredentials(name string, client *AwsClient, imds func() (*ImdsSession, error), visited map[string]bool) (*Credentials, error) {
+	if visited[name] {
+		return nil, fmt.Errorf("Profile %s is its own source_profile", name)
+	}
+	visited[name] = true
+
+	profile, err := loadSharedProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	static := &Credentials{
+		AccessKeyId:     profile["aws_access_key_id"],
+		SecretAccessKey: profile["aws_secret_access_key"],
+		Token:           profile["aws_session_token"],
+	}
+	hasStatic := static.AccessKeyId != "" && static.SecretAccessKey != ""
+
+	role := profile["role_arn"]
+	if role == "" {
+		if !hasStatic {
+			return nil, fmt.Errorf("Profile %s has neither static credentials nor a role_arn", name)
+		}
+
+		return static, nil
+	}
+
+	// A profile which names itself as its source uses its own static
+	// credentials to assume its role
+	var source *Credentials
+	switch sourceProfile, credentialSource := profile["source_profile"], profile["credential_source"]; {
+	case sourceProfile == name && hasStatic:
+		source = static
+	case sourceProfile != "":
+		if source, err = profileCredentials(sourceProfile, client, imds, visited); err != nil {
+			return nil, err
+		}
+	case credentialSource == "Environment":
+		var ok bool
+		if source, ok = EnvCredentials(); !ok {
+			return nil, fmt.Errorf("Profile %s uses credentials from the environment, but none are set", name)
+		}
+	case credentialSource == "Ec2InstanceMetadata":
+		session, err := imds()
+		if err != nil {
+			return nil, err
+		}
+		if source, err = session.GetCredentials(); err != nil {
+			return nil, err
+		}
+	case credentialSource != "":
+		return nil, fmt.Errorf("Profile %s has unsupported credential_source %s", name, credentialSource)
+	default:
+		return nil, fmt.Errorf("Profile %s has a role_arn, but no source_profile or credential_source", name)
+	}
+
+	sessionName := profile["role_session_name"]
+	if sessionName == "" {
+		sessionName = defaultSessionName
+	}
+
+	client.Credentials = source
+	creds, err := client.AssumeRole(role, sessionName, profile["external_id"])
+	if err != nil {
+		return nil, fmt.Errorf("Could not assume role %s for profile %s: %s", role, name, err)
+	}
+
+	return creds, nil
+}
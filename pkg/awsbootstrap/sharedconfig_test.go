@@ -0,0 +1,167 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSharedConfig = `# A comment
+[default]
+region = eu-west-1
+
+[profile static]
+aws_access_key_id = AKIDSTATIC
+aws_secret_access_key = secret
+
+[profile chained]
+role_arn = arn:aws:iam::111122223333:role/chained
+source_profile = static
+external_id = example
+
+[profile instance]
+role_arn = arn:aws:iam::111122223333:role/instance
+credential_source = Ec2InstanceMetadata
+
+[profile env]
+role_arn = arn:aws:iam::111122223333:role/env
+credential_source = Environment
+
+[profile self]
+role_arn = arn:aws:iam::111122223333:role/self
+source_profile = self
+aws_access_key_id = AKIDSELF
+aws_secret_access_key = secret
+
+[profile loop-a]
+role_arn = arn:aws:iam::111122223333:role/loop
+source_profile = loop-b
+
+[profile loop-b]
+role_arn = arn:aws:iam::111122223333:role/loop
+source_profile = loop-a
+
+[profile no-source]
+role_arn = arn:aws:iam::111122223333:role/no-source
+
+[profile sso]
+sso_start_url = https://example.awsapps.com/start
+`
+
+const testSharedCredentials = `[creds-only]
+aws_access_key_id = AKIDCREDS
+aws_secret_access_key = secret
+
+[static]
+aws_session_token = session
+`
+
+// Writes the shared config and credentials files, and points the
+// environment at them
+func sharedConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"config": testSharedConfig, "credentials": testSharedCredentials} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+}
+
+func TestProfileCredentials(t *testing.T) {
+	sharedConfigFiles(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	// A fake STS, which issues credentials named after the role and the
+	// key that assumed it
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signer := sigV4CredentialPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+		query := r.URL.Query()
+		if signer == nil || query.Get("Action") != "AssumeRole" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		role := query.Get("RoleArn")
+		fmt.Fprintf(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>
+			<AccessKeyId>%s:%s:%s</AccessKeyId>
+			<SecretAccessKey>secret</SecretAccessKey>
+		</Credentials></AssumeRoleResult></AssumeRoleResponse>`, role[strings.LastIndex(role, "/")+1:], signer[1], query.Get("ExternalId"))
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		profile   string
+		want      string
+		wantToken string
+		wantError bool
+	}{
+		{profile: "static", want: "AKIDSTATIC", wantToken: "session"},
+		{profile: "creds-only", want: "AKIDCREDS"},
+		{profile: "chained", want: "chained:AKIDSTATIC:example"},
+		{profile: "instance", want: "instance:ASIAINSTANCE:"},
+		{profile: "env", want: "env:AKIDENV:"},
+		{profile: "self", want: "self:AKIDSELF:"},
+		{profile: "loop-a", wantError: true},
+		{profile: "no-source", wantError: true},
+		{profile: "sso", wantError: true},
+		{profile: "missing", wantError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.profile, func(t *testing.T) {
+			client := &AwsClient{
+				Region:     "eu-west-1",
+				Resolver:   testResolver,
+				HTTPClient: server.Client(),
+				Endpoints:  map[string]string{"sts": server.URL},
+			}
+			imds := func() (*ImdsSession, error) {
+				return fakeImds(t, map[string]string{
+					"meta-data/iam/security-credentials/":          "node-role",
+					"meta-data/iam/security-credentials/node-role": `{"AccessKeyId": "ASIAINSTANCE", "SecretAccessKey": "secret"}`,
+				}), nil
+			}
+
+			creds, err := ProfileCredentials(test.profile, client, imds)
+			if test.wantError {
+				if err == nil {
+					t.Errorf("ProfileCredentials() = %+v, want an error", creds)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.AccessKeyId != test.want || creds.Token != test.wantToken {
+				t.Errorf("ProfileCredentials() = %s (token %q), want %s (token %q)", creds.AccessKeyId, creds.Token, test.want, test.wantToken)
+			}
+		})
+	}
+}
+
+func TestSharedConfigProfile(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_DEFAULT_PROFILE", "")
+	if profile := SharedConfigProfile(); profile != "" {
+		t.Errorf("SharedConfigProfile() = %q, want none", profile)
+	}
+
+	t.Setenv("AWS_DEFAULT_PROFILE", "default-profile")
+	if profile := SharedConfigProfile(); profile != "default-profile" {
+		t.Errorf("SharedConfigProfile() = %q, want default-profile", profile)
+	}
+
+	t.Setenv("AWS_PROFILE", "profile")
+	if profile := SharedConfigProfile(); profile != "profile" {
+		t.Errorf("SharedConfigProfile() = %q, want profile", profile)
+	}
+}
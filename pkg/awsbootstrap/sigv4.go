@@ -0,0 +1,166 @@
+package awsbootstrap
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The date formats used by AWS Signature Version 4
+const (
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+)
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AWS uses RFC 3986 encoding, which differs slightly from Go's query
+// escaping (spaces must be %20, and ~ must not be escaped).
+func awsURIEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// Builds the canonical query string, with keys and values sorted and
+// escaped as AWS expects
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsURIEscape(key)+"="+awsURIEscape(value))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// Builds the canonical headers block and the list of signed headers for
+// the given request. The host header is always signed.
+func canonicalHeaders(req *http.Request) (string, string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var canonical strings.Builder
+	for _, key := range keys {
+		canonical.WriteString(key + ":" + headers[key] + "\n")
+	}
+
+	return canonical.String(), strings.Join(keys, ";")
+}
+
+// Calculates the signature for a request, returning it along with the
+// list of signed headers
+func (c *Credentials) signature(req *http.Request, payloadHash, service, region string, t time.Time) (string, string) {
+	headers, signedHeaders := canonicalHeaders(req)
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		headers,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format(sigV4DateFormat), region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		t.Format(sigV4TimeFormat),
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretAccessKey), t.Format(sigV4DateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign)), signedHeaders
+}
+
+// Signs the given request in place with AWS Signature Version 4, adding
+// the Authorization header
+func (c *Credentials) Sign(req *http.Request, body []byte, service, region string, t time.Time) {
+	t = t.UTC()
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.Token)
+	}
+
+	signature, signedHeaders := c.signature(req, payloadHash, service, region, t)
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s/%s/%s/aws4_request, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm,
+		c.AccessKeyId,
+		t.Format(sigV4DateFormat),
+		region,
+		service,
+		signedHeaders,
+		signature,
+	))
+}
+
+// Presigns the given request in place with AWS Signature Version 4,
+// adding the signature to the query string so that the URL can be
+// handed to someone else to make the request. Any headers already on
+// the request are signed, so must be sent with it.
+func (c *Credentials) Presign(req *http.Request, service, region string, expires time.Duration, t time.Time) {
+	t = t.UTC()
+
+	_, signedHeaders := canonicalHeaders(req)
+
+	query := req.URL.Query()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", strings.Join([]string{c.AccessKeyId, t.Format(sigV4DateFormat), region, service, "aws4_request"}, "/"))
+	query.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	if c.Token != "" {
+		query.Set("X-Amz-Security-Token", c.Token)
+	}
+	req.URL.RawQuery = canonicalQuery(query)
+
+	signature, _ := c.signature(req, sha256Hex(nil), service, region, t)
+
+	req.URL.RawQuery += "&X-Amz-Signature=" + signature
+}
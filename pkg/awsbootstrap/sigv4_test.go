@@ -0,0 +1,86 @@
+package awsbootstrap
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Vectors from the AWS Signature Version 4 test suite, all of which are
+// signed with these credentials, at this time, for this scope
+var (
+	sigV4TestCredentials = &Credentials{
+		AccessKeyId:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	sigV4TestTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSignatureTestSuite(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		body      string
+		headers   map[string]string
+		signed    string
+		signature string
+	}{
+		{
+			name:      "get-vanilla",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/",
+			signed:    "host;x-amz-date",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:      "get-vanilla-empty-query-key",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/?Param1=value1",
+			signed:    "host;x-amz-date",
+			signature: "a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb",
+		},
+		{
+			name:      "get-vanilla-query-order-key-case",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signed:    "host;x-amz-date",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:      "post-vanilla",
+			method:    http.MethodPost,
+			url:       "https://example.amazonaws.com/",
+			signed:    "host;x-amz-date",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:      "post-x-www-form-urlencoded",
+			method:    http.MethodPost,
+			url:       "https://example.amazonaws.com/",
+			body:      "Param1=value1",
+			headers:   map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			signed:    "content-type;host;x-amz-date",
+			signature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-Amz-Date", sigV4TestTime.Format(sigV4TimeFormat))
+			for key, value := range test.headers {
+				req.Header.Set(key, value)
+			}
+
+			signature, signed := sigV4TestCredentials.signature(req, sha256Hex([]byte(test.body)), "service", "us-east-1", sigV4TestTime)
+			if signature != test.signature || signed != test.signed {
+				t.Errorf("signature() = %s, %s, want %s, %s", signature, signed, test.signature, test.signed)
+			}
+		})
+	}
+}
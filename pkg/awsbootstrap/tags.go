@@ -0,0 +1,203 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// Configures which instance tags are turned into node labels and
+// taints. For each prefix, any tag starting with it has the prefix
+// removed and the rest of the tag key is used as the label or taint
+// key. Taint tag values are in the Cluster Autoscaler format of
+// <value>:<effect>.
+type TagMapping struct {
+	LabelPrefixes []string `json:"labelPrefixes,omitempty"`
+	TaintPrefixes []string `json:"taintPrefixes,omitempty"`
+}
+
+// Loads an instance's tags with EC2 DescribeTags, following pagination
+func (c *AwsClient) DescribeInstanceTags(instanceID string) (map[string]string, error) {
+	tags := make(map[string]string)
+
+	nextToken := ""
+	for {
+		params := url.Values{
+			"Filter.1.Name":    {"resource-id"},
+			"Filter.1.Value.1": {instanceID},
+			"MaxResults":       {"1000"},
+		}
+		if nextToken != "" {
+			params.Set("NextToken", nextToken)
+		}
+
+		var output struct {
+			Tags []struct {
+				Key   string `xml:"key"`
+				Value string `xml:"value"`
+			} `xml:"tagSet>item"`
+			NextToken string `xml:"nextToken"`
+		}
+		if err := c.callQuery("ec2", "DescribeTags", "2016-11-15", params, &output); err != nil {
+			return nil, err
+		}
+
+		for _, tag := range output.Tags {
+			tags[tag.Key] = tag.Value
+		}
+
+		if output.NextToken == "" {
+			return tags, nil
+		}
+		nextToken = output.NextToken
+	}
+}
+
+// Loads the instance's tags from IMDS. This requires the instance to
+// have been launched with tags in metadata enabled, which EC2 refuses if
+// any tag key contains a "/".
+func (p *Provider) imdsInstanceTags() (map[string]string, error) {
+	keys, err := p.imds.GetString("meta-data/tags/instance")
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Could not load instance tags (%s). Is InstanceMetadataTags enabled in the instance's metadata options?",
+			err,
+		)
+	}
+
+	tags := make(map[string]string)
+	for _, key := range strings.Split(keys, "\n") {
+		if key == "" {
+			continue
+		}
+
+		value, err := p.imds.GetString("meta-data/tags/instance/" + key)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load instance tag %s: %s", key, err)
+		}
+		tags[key] = value
+	}
+
+	return tags, nil
+}
+
+// Loads the instance's tags. When tags in instance metadata are enabled
+// these are read from IMDS: EC2 does not allow that for instances with a
+// "/" in any tag key, so the IMDS list is then complete. Otherwise they
+// come from EC2 DescribeTags, which needs the node's role to allow it.
+// The result, or the failure, is cached after the first call so that
+// each lookup is only tried once.
+func (p *Provider) instanceTags() (map[string]string, error) {
+	if p.tags != nil || p.tagsErr != nil {
+		return p.tags, p.tagsErr
+	}
+
+	tags, err := p.imdsInstanceTags()
+	if err != nil {
+		klog.Infof("Could not load instance tags from IMDS, trying EC2: %s", err)
+		if tags, err = p.describeInstanceTags(); err != nil {
+			err = fmt.Errorf("Could not load instance tags from IMDS or EC2: %s", err)
+		}
+	}
+	p.tags, p.tagsErr = tags, err
+
+	return tags, err
+}
+
+// Loads the instance's tags from EC2
+func (p *Provider) describeInstanceTags() (map[string]string, error) {
+	instanceID, err := p.imds.GetString("meta-data/instance-id")
+	if err != nil {
+		return nil, fmt.Errorf("Could not determine instance ID: %s", err)
+	}
+
+	client, err := p.awsClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.DescribeInstanceTags(instanceID)
+}
+
+// Finds all of the tags with one of the given prefixes, returning them
+// with the prefix stripped
+func tagsWithPrefixes(tags map[string]string, prefixes []string) map[string]string {
+	matched := make(map[string]string)
+	for key, value := range tags {
+		for _, prefix := range prefixes {
+			if name := strings.TrimPrefix(key, prefix); name != key && name != "" {
+				matched[name] = value
+			}
+		}
+	}
+
+	return matched
+}
+
+// Returns the labels derived from the instance's tags. Any which are not
+// valid labels are skipped with a warning.
+func (p *Provider) tagLabels() map[string]string {
+	labels := make(map[string]string)
+
+	mapping := p.tagMapping()
+	if len(mapping.LabelPrefixes) == 0 {
+		return labels
+	}
+
+	tags, err := p.instanceTags()
+	if err != nil {
+		klog.Errorf("Cannot map instance tags to labels: %s", err)
+		return labels
+	}
+
+	for key, value := range tagsWithPrefixes(tags, mapping.LabelPrefixes) {
+		errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...)
+		if len(errs) != 0 {
+			klog.Warningf("Instance tag %s=%s is not a valid label: %s", key, value, strings.Join(errs, ", "))
+			continue
+		}
+
+		labels[key] = value
+	}
+
+	return labels
+}
+
+// Returns the taints derived from the instance's tags. Any which are not
+// valid taints are skipped with a warning.
+func (p *Provider) tagTaints() []v1.Taint {
+	var taints []v1.Taint
+
+	mapping := p.tagMapping()
+	if len(mapping.TaintPrefixes) == 0 {
+		return taints
+	}
+
+	tags, err := p.instanceTags()
+	if err != nil {
+		klog.Errorf("Cannot map instance tags to taints: %s", err)
+		return taints
+	}
+
+	for key, value := range tagsWithPrefixes(tags, mapping.TaintPrefixes) {
+		taintValue, effect, _ := strings.Cut(value, ":")
+		taint := v1.Taint{
+			Key:    key,
+			Value:  taintValue,
+			Effect: v1.TaintEffect(effect),
+		}
+
+		if errs := taintProblems(taint); len(errs) != 0 {
+			klog.Warningf("Instance tag %s=%s is not a valid taint: %s", key, value, strings.Join(errs, ", "))
+			continue
+		}
+
+		taints = append(taints, taint)
+	}
+
+	return taints
+}
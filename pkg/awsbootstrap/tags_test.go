@@ -0,0 +1,199 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Serves DescribeTags for an instance, a page of at most two tags at a
+// time
+func fakeDescribeTags(t *testing.T, instanceID string, tags [][2]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "DescribeTags" || r.Form.Get("Filter.1.Name") != "resource-id" || r.Form.Get("Filter.1.Value.1") != instanceID {
+			t.Errorf("Unexpected request %v", r.Form)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		start := 0
+		fmt.Sscanf(r.Form.Get("NextToken"), "page-%d", &start)
+
+		fmt.Fprint(w, `<DescribeTagsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><tagSet>`)
+		end := start + 2
+		if end > len(tags) {
+			end = len(tags)
+		}
+		for _, tag := range tags[start:end] {
+			fmt.Fprintf(w, `<item><resourceId>%s</resourceId><resourceType>instance</resourceType><key>%s</key><value>%s</value></item>`, instanceID, tag[0], tag[1])
+		}
+		fmt.Fprint(w, `</tagSet>`)
+		if end < len(tags) {
+			fmt.Fprintf(w, `<nextToken>page-%d</nextToken>`, end)
+		}
+		fmt.Fprint(w, `</DescribeTagsResponse>`)
+	}
+}
+
+func TestDescribeInstanceTags(t *testing.T) {
+	client := fakeAws(t, fakeDescribeTags(t, "i-0123456789abcdef0", [][2]string{
+		{"Name", "worker"},
+		{"karpenter.sh/nodepool", "default"},
+		{"karpenter.k8s.aws/ec2nodeclass", "default"},
+		{"aws:autoscaling:groupName", "workers"},
+		{"k8s.io/cluster-autoscaler/node-template/label/team", "platform"},
+	}))
+
+	tags, err := client.DescribeInstanceTags("i-0123456789abcdef0")
+	if err != nil {
+		t.Fatalf("DescribeInstanceTags() returned %v", err)
+	}
+
+	want := map[string]string{
+		"Name":                           "worker",
+		"karpenter.sh/nodepool":          "default",
+		"karpenter.k8s.aws/ec2nodeclass": "default",
+		"aws:autoscaling:groupName":      "workers",
+		"k8s.io/cluster-autoscaler/node-template/label/team": "platform",
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("DescribeInstanceTags() = %v, want %v", tags, want)
+	}
+}
+
+func TestInstanceTagsPreferImds(t *testing.T) {
+	p := Provider{
+		imds: fakeImds(t, map[string]string{
+			"meta-data/instance-id":        "i-0123456789abcdef0",
+			"meta-data/tags/instance":      "Name\nteam",
+			"meta-data/tags/instance/Name": "worker",
+			"meta-data/tags/instance/team": "platform",
+		}),
+		aws: fakeAws(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("Unexpected EC2 request when tags are in IMDS")
+			w.WriteHeader(http.StatusForbidden)
+		}),
+	}
+
+	tags, err := p.instanceTags()
+	if err != nil {
+		t.Fatalf("instanceTags() returned %v", err)
+	}
+	if want := map[string]string{"Name": "worker", "team": "platform"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("instanceTags() = %v, want %v", tags, want)
+	}
+}
+
+func TestInstanceTagsCachesFailure(t *testing.T) {
+	requests := 0
+	p := Provider{
+		imds: fakeImds(t, map[string]string{"meta-data/instance-id": "i-0123456789abcdef0"}),
+		aws: fakeAws(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusForbidden)
+		}),
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.instanceTags(); err == nil {
+			t.Errorf("instanceTags() returned no error")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("DescribeTags was called %d times, want 1", requests)
+	}
+}
+
+func TestTagLabelsAndTaints(t *testing.T) {
+	p := Provider{
+		imds: fakeImds(t, map[string]string{"meta-data/instance-id": "i-0123456789abcdef0"}),
+		aws: fakeAws(t, fakeDescribeTags(t, "i-0123456789abcdef0", [][2]string{
+			{"kios.redcoat.dev/label/example.com/team", "platform"},
+			{"kios.redcoat.dev/label/bad label", "x"},
+			{"k8s.io/cluster-autoscaler/node-template/label/workload", "batch"},
+			{"k8s.io/cluster-autoscaler/node-template/taint/dedicated", "batch:NoSchedule"},
+			{"k8s.io/cluster-autoscaler/node-template/taint/bad", "batch:Sometimes"},
+		})),
+		config: &MetadataInformation{Node: Node{
+			NodeGroupCompatibility: true,
+			TagMapping:             TagMapping{LabelPrefixes: []string{"kios.redcoat.dev/label/"}},
+		}},
+	}
+
+	wantLabels := map[string]string{"example.com/team": "platform", "workload": "batch"}
+	if labels := p.tagLabels(); !reflect.DeepEqual(labels, wantLabels) {
+		t.Errorf("tagLabels() = %v, want %v", labels, wantLabels)
+	}
+
+	wantTaints := []v1.Taint{{Key: "dedicated", Value: "batch", Effect: v1.TaintEffectNoSchedule}}
+	if taints := p.tagTaints(); !reflect.DeepEqual(taints, wantTaints) {
+		t.Errorf("tagTaints() = %v, want %v", taints, wantTaints)
+	}
+}
+
+func TestKarpenterDetection(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     Node
+		tags     [][2]string
+		want     string
+		wantCall bool
+	}{
+		{
+			name: "NodeConfig labels",
+			node: Node{Labels: map[string]string{LabelKarpenterNodePool: "default"}},
+			want: "default",
+		},
+		{
+			name: "not opted in to tag lookup",
+			tags: [][2]string{{"karpenter.sh/nodepool", "default"}},
+		},
+		{
+			name:     "tag lookup",
+			node:     Node{Karpenter: true},
+			tags:     [][2]string{{"karpenter.sh/nodepool", "default"}},
+			want:     "default",
+			wantCall: true,
+		},
+		{
+			name:     "tag lookup, not launched by Karpenter",
+			node:     Node{Karpenter: true},
+			tags:     [][2]string{{"Name", "worker"}},
+			wantCall: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			called := false
+			describeTags := fakeDescribeTags(t, "i-0123456789abcdef0", test.tags)
+			p := Provider{
+				imds: fakeImds(t, map[string]string{"meta-data/instance-id": "i-0123456789abcdef0"}),
+				aws: fakeAws(t, func(w http.ResponseWriter, r *http.Request) {
+					called = true
+					describeTags(w, r)
+				}),
+				config: &MetadataInformation{Node: test.node},
+			}
+
+			if nodePool := p.karpenterNodePool(); nodePool != test.want {
+				t.Errorf("karpenterNodePool() = %q, want %q", nodePool, test.want)
+			}
+			if called != test.wantCall {
+				t.Errorf("DescribeTags called = %t, want %t", called, test.wantCall)
+			}
+
+			var wantTaints []v1.Taint
+			if test.want != "" {
+				wantTaints = []v1.Taint{KarpenterUnregisteredTaint}
+			}
+			if taints := p.karpenterTaints(); !reflect.DeepEqual(taints, wantTaints) {
+				t.Errorf("karpenterTaints() = %v, want %v", taints, wantTaints)
+			}
+		})
+	}
+}
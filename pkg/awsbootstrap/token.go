@@ -0,0 +1,159 @@
+package awsbootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientauth "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
+	"k8s.io/klog/v2"
+)
+
+// EKS tokens are a presigned STS GetCallerIdentity URL, which the
+// cluster calls to find out who we are. The cluster name is included as
+// a signed header so that tokens cannot be replayed against another
+// cluster.
+const (
+	tokenPrefix        = "k8s-aws-v1."
+	clusterIDHeader    = "x-k8s-aws-id"
+	presignedURLExpiry = 60 * time.Second
+
+	// The API server accepts tokens for 15 minutes after they are
+	// signed. Clients are told they expire a minute before this, to allow
+	// for clock drift.
+	tokenExpiry = 14 * time.Minute
+)
+
+// Generates an EKS authentication token for the given cluster, using
+// the client's credentials
+func (c *AwsClient) EKSToken(cluster string, t time.Time) (string, error) {
+	endpoint := c.endpoint("sts") + "/?Action=GetCallerIdentity&Version=2011-06-15"
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("Could not create STS request: %s", err)
+	}
+
+	creds, err := c.credentials()
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set(clusterIDHeader, cluster)
+	creds.Presign(req, "sts", c.Region, presignedURLExpiry, t)
+
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(req.URL.String())), nil
+}
+
+// Returns an ExecCredential containing an EKS token, for use as a
+// kubeconfig exec plugin
+func (c *AwsClient) ExecCredential(cluster string) (*clientauth.ExecCredential, error) {
+	now := time.Now()
+	token, err := c.EKSToken(cluster, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientauth.ExecCredential{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: clientauth.SchemeGroupVersion.String(),
+			Kind:       "ExecCredential",
+		},
+		Status: &clientauth.ExecCredentialStatus{
+			Token:               token,
+			ExpirationTimestamp: &metav1.Time{Time: now.Add(tokenExpiry)},
+		},
+	}, nil
+}
+
+// STS requests must be signed for the region of the endpoint they are
+// sent to, which is not necessarily the node's region. The global
+// endpoint is in us-east-1.
+func stsSigningRegion(endpoint, region string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return region
+	}
+
+	parts := strings.Split(u.Hostname(), ".")
+	if len(parts) < 3 || !strings.HasPrefix(parts[0], "sts") {
+		return region
+	} else if parts[1] == "amazonaws" {
+		return "us-east-1"
+	}
+
+	return parts[1]
+}
+
+// Runs the token command, which prints an ExecCredential for the given
+// cluster using the instance profile's credentials, or those of a role
+// assumed with them. This replaces aws-iam-authenticator as the
+// kubelet's kubeconfig exec plugin.
+func RunToken() {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	cluster := flags.String("cluster", "", "The name of the EKS cluster")
+	region := flags.String("region", "", "The region the cluster is in")
+	roleARN := flags.String("role-arn", "", "A role to assume before generating the token")
+	externalID := flags.String("external-id", "", "The external ID to pass when assuming the role")
+	sessionName := flags.String("session-name", "", "The session name to use when assuming the role")
+	stsEndpoint := flags.String("sts-endpoint", "", "The STS endpoint to use instead of the regional one")
+	fips := flags.Bool("fips", false, "Use FIPS endpoints")
+	flags.Parse(os.Args[2:])
+
+	if *cluster == "" {
+		fatalf("--cluster is required")
+	}
+
+	imds, err := NewImdsSession(30)
+	if err != nil {
+		fatalf("Could not create IMDS Session: %s", err)
+	}
+
+	if *region == "" {
+		if *region, err = imds.GetString("meta-data/placement/region"); err != nil {
+			fatalf("Could not determine region: %s", err)
+		}
+	}
+
+	resolver, err := NewResolver(*region, *fips)
+	if err != nil {
+		fatalf("%s", err)
+	}
+
+	client, err := NewAwsClient(imds, resolver)
+	if err != nil {
+		fatalf("Could not load credentials: %s", err)
+	}
+
+	if *stsEndpoint != "" {
+		client.Endpoints = map[string]string{"sts": *stsEndpoint}
+		client.Region = stsSigningRegion(*stsEndpoint, *region)
+	}
+
+	if *roleARN != "" {
+		if *sessionName == "" {
+			if *sessionName, err = imds.GetString("meta-data/instance-id"); err != nil {
+				fatalf("Could not determine instance ID: %s", err)
+			}
+		}
+
+		if client.Credentials, err = client.AssumeRole(*roleARN, *sessionName, *externalID); err != nil {
+			fatalf("Could not assume role %s: %s", *roleARN, err)
+		}
+	}
+
+	credential, err := client.ExecCredential(*cluster)
+	if err != nil {
+		fatalf("Could not generate token: %s", err)
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(credential); err != nil {
+		klog.Errorf("Could not write ExecCredential: %s", err)
+	}
+}
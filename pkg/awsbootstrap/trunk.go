@@ -0,0 +1,70 @@
+package awsbootstrap
+
+import (
+	"fmt"
+
+	"k8s.io/klog/v2"
+)
+
+// The AWS VPC Resource Controller watches for nodes with this label set
+// to "false" and attaches a trunk ENI to them, before updating it to
+// "true".
+const LabelHasTrunkAttached = "vpc.amazonaws.com/has-trunk-attached"
+
+// Instance families which run on the Xen hypervisor, rather than Nitro.
+// These do not support ENI trunking at all.
+var xenFamilies = map[string]bool{
+	"c1": true, "c3": true, "c4": true,
+	"d2": true,
+	"f1": true,
+	"g2": true, "g3": true, "g3s": true,
+	"h1": true,
+	"i2": true, "i3": true,
+	"m1": true, "m2": true, "m3": true, "m4": true,
+	"p2": true, "p3": true,
+	"r3": true, "r4": true,
+	"t1": true, "t2": true,
+	"x1": true, "x1e": true,
+}
+
+// Returns the trunking limits for the given instance type, or an error
+// explaining why it cannot be used with pod ENIs
+func trunkingLimit(instanceType string) (TrunkingLimit, error) {
+	family, size := splitInstanceType(instanceType)
+
+	// Bare metal instances of Xen families are still Nitro based
+	if xenFamilies[family] && size != "metal" {
+		return TrunkingLimit{}, fmt.Errorf("%s is not a Nitro instance type", instanceType)
+	}
+
+	limit, ok := TrunkingLimits[instanceType]
+	if !ok {
+		return TrunkingLimit{}, fmt.Errorf("%s does not support ENI trunking", instanceType)
+	}
+
+	return limit, nil
+}
+
+// Checks whether pod ENI mode has been requested, and is supported by
+// this instance type. If it has been requested but is not supported,
+// the bootstrap fails, as the VPC Resource Controller would never
+// attach a trunk and pods with security groups would never start.
+func (p *Provider) podENI() (TrunkingLimit, bool) {
+	if !p.config.Node.MaxPods.PodENI {
+		return TrunkingLimit{}, false
+	}
+
+	if p.trunking == nil {
+		instanceType, _ := p.imds.GetString("meta-data/instance-type")
+
+		limit, err := trunkingLimit(instanceType)
+		if err != nil {
+			fatalf("Refusing to enable pod ENI mode: %s", err)
+		}
+
+		klog.Infof("Pod ENI mode enabled. %s supports %d branch interfaces", instanceType, limit.BranchInterfaces)
+		p.trunking = &limit
+	}
+
+	return *p.trunking, true
+}
@@ -0,0 +1,88 @@
+package awsbootstrap
+
+import "testing"
+
+func TestTrunkingLimit(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		wantErr      bool
+	}{
+		{"m5.large", false},
+		{"c5.metal", false},
+		{"m4.large", true},
+		{"t2.micro", true},
+		{"t3.nano", true},
+		{"nonsense", true},
+	}
+
+	for _, test := range tests {
+		_, err := trunkingLimit(test.instanceType)
+		if (err != nil) != test.wantErr {
+			t.Errorf("trunkingLimit(%s) error = %v, want error %t", test.instanceType, err, test.wantErr)
+		}
+	}
+}
+
+// Every trunking instance type's ENI limits should agree with its pod
+// limit in the catalog
+func TestTrunkingLimitsMatchCatalog(t *testing.T) {
+	for instanceType, limit := range TrunkingLimits {
+		podLimit, ok := PodLimits[instanceType]
+		if !ok {
+			t.Errorf("%s is in TrunkingLimits but not PodLimits", instanceType)
+			continue
+		}
+
+		if want := limit.Interfaces * (limit.IPv4PerInterface - 1); podLimit != want {
+			t.Errorf("%s has a pod limit of %d, but its ENI limits give %d", instanceType, podLimit, want)
+		}
+	}
+}
+
+func TestMaxPodsWithPodENI(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		want   int32
+	}{
+		{
+			name:   "catalog",
+			limits: Limits{Set: true, Offset: 3, PodENI: true},
+			// 3 * (10 - 1), less the trunk's 9 IPs
+			want: 27 - 9 + 3,
+		},
+		{
+			name:   "override is final",
+			limits: Limits{Set: true, Offset: 3, PodENI: true, Overrides: map[string]int{"m5.large": 100}},
+			want:   100 + 3,
+		},
+		{
+			name:   "override below the trunk's IPs",
+			limits: Limits{Set: true, Offset: 3, PodENI: true, Overrides: map[string]int{"m5.large": 5}},
+			want:   5 + 3,
+		},
+		{
+			name:   "override for another instance type",
+			limits: Limits{Set: true, Offset: 3, PodENI: true, Overrides: map[string]int{"m5.xlarge": 100}},
+			want:   27 - 9 + 3,
+		},
+		{
+			name:   "without pod ENI",
+			limits: Limits{Set: true, Offset: 3},
+			want:   27 + 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Provider{
+				imds:   fakeImds(t, map[string]string{"meta-data/instance-type": "m5.large"}),
+				config: &MetadataInformation{Node: Node{MaxPods: test.limits}},
+			}
+
+			if got, _ := p.maxPods(); got != test.want {
+				t.Errorf("maxPods() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package awsbootstrap
+
+// Network interface details for instance types which support ENI
+// trunking (used by security groups for pods). Interfaces is the
+// maximum number of ENIs the instance type can have attached,
+// IPv4PerInterface the number of IPv4 addresses each can have, and
+// BranchInterfaces is the number of branch ENIs that can be created on
+// its trunk ENI.
+//
+// Branch interface counts follow those used by the AWS VPC Resource
+// Controller. Instance types not in this list are treated as not
+// supporting trunking.
+type TrunkingLimit struct {
+	Interfaces       int
+	IPv4PerInterface int
+	BranchInterfaces int
+}
+
+var TrunkingLimits = map[string]TrunkingLimit{
+	"c5.12xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5.18xlarge":    {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5.24xlarge":    {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5.2xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c5.4xlarge":     {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5.9xlarge":     {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5.large":       {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c5.metal":       {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5.xlarge":      {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c5a.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5a.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5a.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5a.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c5a.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5a.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5a.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c5a.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c5ad.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5ad.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5ad.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5ad.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c5ad.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5ad.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5ad.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c5ad.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c5d.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5d.18xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5d.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5d.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c5d.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5d.9xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5d.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c5d.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5d.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c5n.18xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5n.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c5n.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5n.9xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c5n.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c5n.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c5n.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c6a.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6a.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6a.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6a.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c6a.32xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6a.48xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6a.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6a.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6a.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c6a.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6a.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c6g.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6g.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6g.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c6g.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6g.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6g.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c6g.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6g.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c6gd.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6gd.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6gd.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c6gd.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6gd.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6gd.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c6gd.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6gd.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c6gn.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6gn.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6gn.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c6gn.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6gn.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6gn.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c6gn.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c6i.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6i.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6i.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6i.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c6i.32xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6i.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6i.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6i.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c6i.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6i.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c6id.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6id.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6id.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6id.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c6id.32xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6id.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6id.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6id.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c6id.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6id.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c6in.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6in.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6in.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c6in.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c6in.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6in.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c6in.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c6in.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"c7g.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c7g.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c7g.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"c7g.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c7g.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"c7g.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"c7g.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"c7g.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m5.12xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5.16xlarge":    {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5.24xlarge":    {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5.2xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m5.4xlarge":     {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5.8xlarge":     {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5.large":       {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m5.metal":       {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5.xlarge":      {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m5a.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5a.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5a.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5a.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m5a.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5a.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5a.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m5a.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m5ad.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5ad.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5ad.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5ad.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m5ad.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5ad.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5ad.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m5ad.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m5d.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5d.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5d.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5d.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m5d.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5d.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5d.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m5d.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5d.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m5dn.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5dn.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5dn.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5dn.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m5dn.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5dn.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5dn.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m5dn.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5dn.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m5n.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5n.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5n.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5n.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m5n.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5n.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m5n.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m5n.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5n.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m5zn.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m5zn.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m5zn.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m5zn.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m6a.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6a.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6a.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6a.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m6a.32xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6a.48xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6a.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6a.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6a.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m6a.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6a.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m6g.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6g.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6g.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m6g.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6g.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6g.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m6g.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6g.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m6gd.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6gd.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6gd.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m6gd.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6gd.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6gd.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m6gd.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6gd.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m6i.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6i.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6i.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6i.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m6i.32xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6i.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6i.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6i.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m6i.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6i.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m6id.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6id.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6id.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6id.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m6id.32xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6id.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6id.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6id.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m6id.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6id.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m6idn.12xlarge": {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6idn.16xlarge": {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6idn.24xlarge": {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6idn.2xlarge":  {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m6idn.4xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6idn.8xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6idn.large":    {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m6idn.xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"m6in.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6in.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6in.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"m6in.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"m6in.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6in.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"m6in.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"m6in.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r5.12xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5.16xlarge":    {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5.24xlarge":    {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5.2xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r5.4xlarge":     {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5.8xlarge":     {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5.large":       {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r5.metal":       {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5.xlarge":      {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r5a.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5a.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5a.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5a.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r5a.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5a.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5a.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r5a.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r5ad.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5ad.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5ad.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5ad.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r5ad.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5ad.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5ad.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r5ad.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r5b.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5b.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5b.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5b.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r5b.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5b.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5b.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r5b.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5b.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r5d.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5d.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5d.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5d.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r5d.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5d.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5d.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r5d.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5d.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r5dn.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5dn.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5dn.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5dn.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r5dn.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5dn.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5dn.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r5dn.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5dn.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r5n.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5n.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5n.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5n.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r5n.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5n.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r5n.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r5n.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r5n.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r6a.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6a.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6a.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6a.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r6a.32xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6a.48xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6a.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6a.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6a.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r6a.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6a.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r6g.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6g.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6g.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r6g.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6g.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6g.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r6g.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6g.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r6gd.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6gd.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6gd.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r6gd.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6gd.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6gd.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r6gd.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6gd.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r6i.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6i.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6i.24xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6i.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r6i.32xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6i.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6i.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6i.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r6i.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6i.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r6id.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6id.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6id.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6id.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r6id.32xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6id.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6id.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6id.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r6id.metal":     {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6id.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r6idn.12xlarge": {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6idn.16xlarge": {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6idn.24xlarge": {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6idn.2xlarge":  {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r6idn.4xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6idn.8xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6idn.large":    {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r6idn.xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r6in.12xlarge":  {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6in.16xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6in.24xlarge":  {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r6in.2xlarge":   {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r6in.4xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6in.8xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r6in.large":     {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r6in.xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+	"r7g.12xlarge":   {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r7g.16xlarge":   {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r7g.2xlarge":    {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 38},
+	"r7g.4xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r7g.8xlarge":    {Interfaces: 8, IPv4PerInterface: 30, BranchInterfaces: 54},
+	"r7g.large":      {Interfaces: 3, IPv4PerInterface: 10, BranchInterfaces: 9},
+	"r7g.metal":      {Interfaces: 15, IPv4PerInterface: 50, BranchInterfaces: 107},
+	"r7g.xlarge":     {Interfaces: 4, IPv4PerInterface: 15, BranchInterfaces: 18},
+}
@@ -4,15 +4,51 @@ import (
 	"github.com/EmilyShepherd/kios-go-sdk/pkg/bootstrap"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubelet "k8s.io/kubelet/config/v1beta1"
 )
 
 const ApiVersion = "kios.redcoat.dev/v1alpha1"
 const Kind = "AWSMetadataInformation"
 
 type ApiServer struct {
-	Name     string `json:"name"`
+	Name string `json:"name"`
+
+	// One or more PEM CA certificates, which may also be base64 encoded
 	CA       string `json:"b64ClusterCA"`
 	Endpoint string `json:"endpoint"`
+
+	// API server endpoints to try in order, eg the private endpoint, then
+	// a PrivateLink alias, then the public one. They are all checked at
+	// once, and the first which is healthy is used. This replaces
+	// Endpoint.
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	// The cluster CA can instead be loaded from a reference (see
+	// Provider.LoadReference). If ClusterCASHA256 is set, the referenced
+	// data must have that hex encoded SHA-256 hash.
+	ClusterCAFrom   string `json:"clusterCAFrom,omitempty"`
+	ClusterCASHA256 string `json:"clusterCASHA256,omitempty"`
+
+	// The cluster's service CIDR. If this is not set, EKS' default is
+	// assumed.
+	ServiceCIDR string `json:"serviceCIDR,omitempty"`
+
+	// A role for the node to assume before authenticating with the
+	// cluster, eg when the cluster is in another account. ExternalID and
+	// SessionName (a template, see auth.go) are used when assuming it.
+	RoleARN     string `json:"roleARN,omitempty"`
+	ExternalID  string `json:"externalID,omitempty"`
+	SessionName string `json:"sessionName,omitempty"`
+
+	// The STS endpoint to use instead of the regional one
+	STSEndpoint string `json:"stsEndpoint,omitempty"`
+
+	// How the node authenticates: "iam-authenticator" (the default) or
+	// "bootstrap-token". In bootstrap-token mode, the token is given
+	// either inline or as a reference (see Provider.LoadReference).
+	Auth               string `json:"auth,omitempty"`
+	BootstrapToken     string `json:"bootstrapToken,omitempty"`
+	BootstrapTokenFrom string `json:"bootstrapTokenFrom,omitempty"`
 }
 
 type Node struct {
@@ -21,11 +57,113 @@ type Node struct {
 	MaxPods              Limits                                  `json:"maxPods"`
 	KubeletConfiguration string                                  `json:"kubeletConfiguration,omitempty"`
 	ContainerRuntime     bootstrap.ContainerRuntimeConfiguration `json:"containerRuntime,omitempty"`
+
+	// Annotations to apply to the node once it has registered. Unlike
+	// labels, these can hold long values such as URLs.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// How to choose the node's hostname (see hostname.go). Hostname is
+	// only used with the explicit policy.
+	HostnamePolicy string `json:"hostnamePolicy,omitempty"`
+	Hostname       string `json:"hostname,omitempty"`
+
+	// Optional sets of labels, generated from the instance metadata, to
+	// add to the node (see labelsets.go)
+	LabelSets []string `json:"labelSets,omitempty"`
+
+	// Which of the instance's tags should be turned into labels and
+	// taints
+	TagMapping TagMapping `json:"tagMapping,omitempty"`
+
+	// Adds the labels that EKS managed node groups and Cluster Autoscaler
+	// expect, so that kiOS nodes are interchangeable with managed ones
+	NodeGroupCompatibility bool `json:"nodeGroupCompatibility,omitempty"`
+
+	// Looks up the instance's tags to find its Karpenter NodePool. This is
+	// only needed when Karpenter does not generate the user data (ie the
+	// EC2NodeClass uses the Custom AMI family)
+	Karpenter bool `json:"karpenter,omitempty"`
+
+	// A reference (see Provider.LoadReference) to a kubeconfig which is
+	// allowed to patch Node objects. If set, labels which NodeRestriction
+	// will not let the kubelet set are applied with it after the node
+	// has registered.
+	PrivilegedKubeconfig string `json:"privilegedKubeconfig,omitempty"`
+
+	// What to do if the final kubelet configuration is invalid. Either
+	// "reject" or "degrade" (the default).
+	KubeletValidationPolicy string `json:"kubeletValidationPolicy,omitempty"`
+
+	// Forces FIPS endpoints to be used for all AWS services, in
+	// partitions which have them
+	FIPS bool `json:"fips,omitempty"`
+
+	// How to set the node up for any GPUs or other accelerators it has
+	Accelerators AcceleratorOptions `json:"accelerators,omitempty"`
+
+	// The version of the kubelet, if it cannot be found from the kubelet
+	// binary. This is used to pick API versions the kubelet supports.
+	KubeletVersion string `json:"kubeletVersion,omitempty"`
+
+	// Attaches the node's signed instance identity document to it as an
+	// annotation, for the CSR approver to check
+	AttachIdentityDocument bool `json:"attachIdentityDocument,omitempty"`
+
+	// Settings for the ECR credential provider
+	ECR ECRCredentialProviderOptions `json:"ecr,omitempty"`
+
+	// Image credential providers to use in addition to, or instead of,
+	// the ECR credential provider
+	CredentialProviders CredentialProviderOptions `json:"credentialProviders,omitempty"`
+}
+
+type CredentialProviderOptions struct {
+	// Drops the default ECR credential provider
+	Replace bool `json:"replace,omitempty"`
+
+	// Providers to add. Any with the same name as a default provider
+	// patch it instead: their matchImages and env are added to the
+	// default's, and any other fields which are set replace the
+	// default's.
+	Providers []kubelet.CredentialProvider `json:"providers,omitempty"`
+}
+
+type AcceleratorOptions struct {
+	// Registers the node with a NoSchedule taint for its accelerators
+	Taint bool `json:"taint,omitempty"`
+
+	// Adds a CRI-O runtime handler for the accelerators. By default,
+	// this is the handler the manufacturer's toolkit provides (currently
+	// only NVIDIA's), but it can be overridden with RuntimeHandler.
+	ConfigureRuntime bool            `json:"configureRuntime,omitempty"`
+	RuntimeHandler   *RuntimeHandler `json:"runtimeHandler,omitempty"`
+
+	// Makes the runtime handler CRI-O's default, rather than only
+	// available via a RuntimeClass
+	DefaultRuntime bool `json:"defaultRuntime,omitempty"`
 }
 
 type Limits struct {
 	Set    bool `json:"set"`
 	Offset int  `json:"offset"`
+
+	// Pod limits (before the offset is applied) keyed by instance type.
+	// These take precedence over the compiled in PodLimits, and can be
+	// used for instance types which kiOS does not yet know about.
+	Overrides map[string]int `json:"overrides,omitempty"`
+
+	// Pod limits in the amazon-eks-ami eni-max-pods.txt format, either
+	// inline or as a reference (see Provider.LoadReference). Entries in
+	// these take precedence over the compiled in PodLimits.
+	EniMaxPods     string `json:"eniMaxPods,omitempty"`
+	EniMaxPodsFrom string `json:"eniMaxPodsFrom,omitempty"`
+
+	// Set this when the AWS VPC CNI is running with ENABLE_POD_ENI (ie
+	// security groups for pods). One of the node's ENIs is then used as
+	// the trunk ENI, so is not available for pod IPs.
+	PodENI bool `json:"podENI,omitempty"`
+
+	eniMaxPods map[string]int
 }
 
 type MetadataInformation struct {
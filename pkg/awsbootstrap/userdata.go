@@ -0,0 +1,177 @@
+package awsbootstrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// The AL2023 node configuration format, which Karpenter (and other EKS
+// tooling) generates. We only read the parts which have an equivalent
+// in MetadataInformation.
+const NodeConfigApiVersion = "node.eks.aws/v1alpha1"
+const NodeConfigKind = "NodeConfig"
+
+type nodeConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Spec struct {
+		Cluster struct {
+			Name                 string `json:"name"`
+			APIServerEndpoint    string `json:"apiServerEndpoint"`
+			CertificateAuthority string `json:"certificateAuthority"`
+			CIDR                 string `json:"cidr"`
+		} `json:"cluster"`
+		Kubelet struct {
+			Config map[string]interface{} `json:"config"`
+			Flags  []string               `json:"flags"`
+		} `json:"kubelet"`
+	} `json:"spec"`
+}
+
+// Parses the instance's user data into the given MetadataInformation.
+// This is normally a single kiOS YAML document, however tools such as
+// Karpenter wrap user data in a MIME multipart document alongside their
+// own generated configuration, so each part of those is parsed in turn.
+func parseUserData(raw []byte, data *MetadataInformation) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil || !strings.HasPrefix(msg.Header.Get("Content-Type"), "multipart/") {
+		return parseUserDataPart(raw, "", data)
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("Could not parse user data Content-Type: %s", err)
+	}
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Could not read user data part: %s", err)
+		}
+
+		body, err := io.ReadAll(part)
+		if err != nil {
+			return fmt.Errorf("Could not read user data part: %s", err)
+		}
+
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+			if body, err = base64.StdEncoding.DecodeString(string(body)); err != nil {
+				klog.Warningf("Ignoring user data part which is not valid base64: %s", err)
+				continue
+			}
+		}
+
+		if err := parseUserDataPart(body, part.Header.Get("Content-Type"), data); err != nil {
+			klog.Warningf("Ignoring user data part: %s", err)
+		}
+	}
+}
+
+// Parses a single user data document, which is either kiOS'
+// MetadataInformation or an AL2023 NodeConfig
+func parseUserDataPart(raw []byte, contentType string, data *MetadataInformation) error {
+	if strings.HasPrefix(contentType, "text/x-shellscript") {
+		klog.Info("Skipping shell script in user data. kiOS does not run user data scripts")
+		return nil
+	}
+
+	var meta metav1.TypeMeta
+	if err := yaml.Unmarshal(raw, &meta); err != nil {
+		return fmt.Errorf("Could not parse user data: %s", err)
+	}
+
+	if meta.APIVersion == NodeConfigApiVersion && meta.Kind == NodeConfigKind {
+		var config nodeConfig
+		if err := yaml.Unmarshal(raw, &config); err != nil {
+			return fmt.Errorf("Could not parse NodeConfig: %s", err)
+		}
+
+		return config.applyTo(data)
+	}
+
+	if err := yaml.Unmarshal(raw, data); err != nil {
+		return fmt.Errorf("Could not parse user data: %s", err)
+	}
+
+	return nil
+}
+
+// Copies the settings from a NodeConfig into the MetadataInformation.
+// Anything already set (eg by a kiOS document in the same user data) is
+// left alone.
+func (c *nodeConfig) applyTo(data *MetadataInformation) error {
+	klog.Info("Loading settings from NodeConfig in user data")
+
+	setIfEmpty(&data.ApiServer.Name, c.Spec.Cluster.Name)
+	if len(data.ApiServer.Endpoints) == 0 {
+		setIfEmpty(&data.ApiServer.Endpoint, c.Spec.Cluster.APIServerEndpoint)
+	}
+	if data.ApiServer.ClusterCAFrom == "" {
+		setIfEmpty(&data.ApiServer.CA, c.Spec.Cluster.CertificateAuthority)
+	}
+	setIfEmpty(&data.ApiServer.ServiceCIDR, c.Spec.Cluster.CIDR)
+
+	if data.Node.KubeletConfiguration == "" && len(c.Spec.Kubelet.Config) != 0 {
+		config, err := yaml.Marshal(c.Spec.Kubelet.Config)
+		if err != nil {
+			return fmt.Errorf("Could not convert NodeConfig kubelet config: %s", err)
+		}
+		data.Node.KubeletConfiguration = string(config)
+	}
+
+	for _, flag := range c.Spec.Kubelet.Flags {
+		name, value, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+		value = strings.Trim(value, `"'`)
+
+		switch name {
+		case "node-labels":
+			if data.Node.Labels == nil {
+				data.Node.Labels = make(map[string]string)
+			}
+			for _, label := range strings.Split(value, ",") {
+				if key, value, ok := strings.Cut(label, "="); ok {
+					if _, exists := data.Node.Labels[key]; !exists {
+						data.Node.Labels[key] = value
+					}
+				}
+			}
+		case "register-with-taints":
+			for _, taint := range strings.Split(value, ",") {
+				if taint == "" {
+					continue
+				}
+				keyValue, effect, _ := strings.Cut(taint, ":")
+				key, value, _ := strings.Cut(keyValue, "=")
+				data.Node.Taints = append(data.Node.Taints, v1.Taint{
+					Key:    key,
+					Value:  value,
+					Effect: v1.TaintEffect(effect),
+				})
+			}
+		default:
+			klog.Warningf("Ignoring unsupported kubelet flag in NodeConfig: %s", flag)
+		}
+	}
+
+	return nil
+}
+
+func setIfEmpty(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
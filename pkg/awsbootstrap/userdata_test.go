@@ -0,0 +1,180 @@
+package awsbootstrap
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const kiosDocument = `apiVersion: kios.redcoat.dev/v1alpha1
+kind: MetadataInformation
+apiServer:
+  name: kios-cluster
+  endpoint: https://kios.example.com
+node:
+  labels:
+    team: platform
+`
+
+const nodeConfigDocument = `apiVersion: node.eks.aws/v1alpha1
+kind: NodeConfig
+spec:
+  cluster:
+    name: eks-cluster
+    apiServerEndpoint: https://eks.example.com
+    certificateAuthority: Q0EK
+    cidr: 10.100.0.0/16
+  kubelet:
+    config:
+      maxPods: 42
+    flags:
+    - --node-labels=karpenter.sh/nodepool=default,team=batch
+    - --register-with-taints="dedicated=batch:NoSchedule"
+    - --v=2
+`
+
+// Wraps the given parts in a MIME multipart document, as Karpenter
+// generates
+func mimeMultipart(parts ...string) string {
+	var doc strings.Builder
+	doc.WriteString("MIME-Version: 1.0\nContent-Type: multipart/mixed; boundary=\"BOUNDARY\"\n\n")
+	for _, part := range parts {
+		doc.WriteString("--BOUNDARY\n" + part + "\n")
+	}
+	doc.WriteString("--BOUNDARY--\n")
+
+	return doc.String()
+}
+
+func TestParseUserData(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantName string
+		wantErr  bool
+	}{
+		{
+			name:     "plain kiOS document",
+			raw:      kiosDocument,
+			wantName: "kios-cluster",
+		},
+		{
+			name:     "plain NodeConfig",
+			raw:      nodeConfigDocument,
+			wantName: "eks-cluster",
+		},
+		{
+			name: "multipart with a shell script",
+			raw: mimeMultipart(
+				"Content-Type: text/x-shellscript; charset=\"us-ascii\"\n\n#!/bin/bash\necho hello",
+				"Content-Type: application/node.eks.aws\n\n"+nodeConfigDocument,
+			),
+			wantName: "eks-cluster",
+		},
+		{
+			name: "multipart with a base64 part",
+			raw: mimeMultipart(
+				"Content-Type: application/x-yaml\nContent-Transfer-Encoding: base64\n\n" +
+					base64.StdEncoding.EncodeToString([]byte(kiosDocument)),
+			),
+			wantName: "kios-cluster",
+		},
+		{
+			name: "kiOS document takes precedence over a later NodeConfig",
+			raw: mimeMultipart(
+				"Content-Type: application/x-yaml\n\n"+kiosDocument,
+				"Content-Type: application/node.eks.aws\n\n"+nodeConfigDocument,
+			),
+			wantName: "kios-cluster",
+		},
+		{
+			name: "invalid parts are skipped",
+			raw: mimeMultipart(
+				"Content-Type: application/x-yaml\n\n: not: [valid",
+				"Content-Type: application/x-yaml\nContent-Transfer-Encoding: base64\n\n!!!",
+				"Content-Type: application/x-yaml\n\n"+kiosDocument,
+			),
+			wantName: "kios-cluster",
+		},
+		{
+			name:    "invalid YAML",
+			raw:     "apiServer: [",
+			wantErr: true,
+		},
+		{
+			name: "empty",
+			raw:  "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data MetadataInformation
+			err := parseUserData([]byte(test.raw), &data)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseUserData() error = %v, want error %t", err, test.wantErr)
+			}
+
+			if data.ApiServer.Name != test.wantName {
+				t.Errorf("ApiServer.Name = %q, want %q", data.ApiServer.Name, test.wantName)
+			}
+		})
+	}
+}
+
+func TestNodeConfigApplyTo(t *testing.T) {
+	var data MetadataInformation
+	if err := parseUserData([]byte(nodeConfigDocument), &data); err != nil {
+		t.Fatalf("parseUserData() returned %v", err)
+	}
+
+	want := ApiServer{
+		Name:        "eks-cluster",
+		Endpoint:    "https://eks.example.com",
+		CA:          "Q0EK",
+		ServiceCIDR: "10.100.0.0/16",
+	}
+	if !reflect.DeepEqual(data.ApiServer, want) {
+		t.Errorf("ApiServer = %+v, want %+v", data.ApiServer, want)
+	}
+
+	if data.Node.KubeletConfiguration != "maxPods: 42\n" {
+		t.Errorf("KubeletConfiguration = %q", data.Node.KubeletConfiguration)
+	}
+
+	wantLabels := map[string]string{"karpenter.sh/nodepool": "default", "team": "batch"}
+	if !reflect.DeepEqual(data.Node.Labels, wantLabels) {
+		t.Errorf("Labels = %v, want %v", data.Node.Labels, wantLabels)
+	}
+
+	wantTaints := []v1.Taint{{Key: "dedicated", Value: "batch", Effect: v1.TaintEffectNoSchedule}}
+	if !reflect.DeepEqual(data.Node.Taints, wantTaints) {
+		t.Errorf("Taints = %v, want %v", data.Node.Taints, wantTaints)
+	}
+}
+
+// Settings from a kiOS document are not overwritten by a NodeConfig,
+// including where the kiOS document uses an alternative to the field
+// the NodeConfig sets
+func TestNodeConfigDoesNotOverride(t *testing.T) {
+	data := MetadataInformation{
+		ApiServer: ApiServer{
+			Endpoints:     []string{"https://private.example.com"},
+			ClusterCAFrom: "ssm:/kios/ca",
+		},
+		Node: Node{Labels: map[string]string{"team": "platform"}},
+	}
+	if err := parseUserData([]byte(nodeConfigDocument), &data); err != nil {
+		t.Fatalf("parseUserData() returned %v", err)
+	}
+
+	if data.ApiServer.Endpoint != "" || data.ApiServer.CA != "" {
+		t.Errorf("NodeConfig set endpoint %q and CA %q alongside their alternatives", data.ApiServer.Endpoint, data.ApiServer.CA)
+	}
+	if data.Node.Labels["team"] != "platform" {
+		t.Errorf("NodeConfig overrode label team=%s", data.Node.Labels["team"])
+	}
+}
@@ -0,0 +1,326 @@
+package awsbootstrap
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	kubelet "k8s.io/kubelet/config/v1beta1"
+)
+
+// What to do when the kubelet configuration fails validation
+const (
+	// The bootstrap exits without writing the configuration
+	ValidationPolicyReject = "reject"
+
+	// Invalid fields are reset to safe defaults, and the bootstrap
+	// continues
+	ValidationPolicyDegrade = "degrade"
+)
+
+// Matches the providerID format that EKS expects
+var providerIDPattern = regexp.MustCompile(`^aws:///[a-z0-9-]+/i-[0-9a-f]+$`)
+
+// The eviction signals that the kubelet understands
+var evictionSignals = map[string]bool{
+	"memory.available":            true,
+	"nodefs.available":            true,
+	"nodefs.inodesFree":           true,
+	"imagefs.available":           true,
+	"imagefs.inodesFree":          true,
+	"pid.available":               true,
+	"allocatableMemory.available": true,
+}
+
+// The resources that can be reserved for the system or kube components
+var reservableResources = map[string]bool{
+	string(v1.ResourceCPU):              true,
+	string(v1.ResourceMemory):           true,
+	string(v1.ResourceEphemeralStorage): true,
+	"pid":                               true,
+}
+
+// A single problem found with the kubelet configuration. If the policy
+// is to degrade, reset is called to put the field back to a safe value.
+type configProblem struct {
+	field   string
+	message string
+	reset   func(*kubelet.KubeletConfiguration)
+}
+
+type configValidator struct {
+	problems []configProblem
+}
+
+// Records a problem if ok is false
+func (v *configValidator) check(ok bool, field, message string, reset func(*kubelet.KubeletConfiguration)) {
+	if !ok {
+		v.problems = append(v.problems, configProblem{field, message, reset})
+	}
+}
+
+func (v *configValidator) percent(value *int32, field string, reset func(*kubelet.KubeletConfiguration)) {
+	if value != nil {
+		v.check(*value >= 0 && *value <= 100, field, fmt.Sprintf("must be between 0 and 100, got %d", *value), reset)
+	}
+}
+
+func (v *configValidator) nonNegative(value int64, field string, reset func(*kubelet.KubeletConfiguration)) {
+	v.check(value >= 0, field, fmt.Sprintf("must not be negative, got %d", value), reset)
+}
+
+func (v *configValidator) port(value int64, field string, reset func(*kubelet.KubeletConfiguration)) {
+	v.check(value >= 0 && value <= 65535, field, fmt.Sprintf("must be a valid port, got %d", value), reset)
+}
+
+// Checks an eviction threshold value, which is either a percentage or a
+// resource quantity
+func validThreshold(value string) error {
+	if strings.HasSuffix(value, "%") {
+		var percent float64
+		if _, err := fmt.Sscanf(value, "%f%%", &percent); err != nil || percent < 0 || percent > 100 {
+			return fmt.Errorf("invalid percentage %q", value)
+		}
+		return nil
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return fmt.Errorf("invalid quantity %q", value)
+	}
+	if quantity.Sign() < 0 {
+		return fmt.Errorf("must not be negative, got %q", value)
+	}
+
+	return nil
+}
+
+// Validates a map of eviction signals to thresholds
+func (v *configValidator) thresholds(thresholds map[string]string, field string, reset func(*kubelet.KubeletConfiguration)) {
+	for signal, value := range thresholds {
+		v.check(evictionSignals[signal], field+"["+signal+"]", "unknown eviction signal", reset)
+		if err := validThreshold(value); err != nil {
+			v.check(false, field+"["+signal+"]", err.Error(), reset)
+		}
+	}
+}
+
+// Validates a map of resources to reserved quantities
+func (v *configValidator) reserved(reserved map[string]string, field string, reset func(*kubelet.KubeletConfiguration)) {
+	for name, value := range reserved {
+		v.check(reservableResources[name], field+"["+name+"]", "unknown resource", reset)
+		quantity, err := resource.ParseQuantity(value)
+		v.check(err == nil && quantity.Sign() >= 0, field+"["+name+"]", fmt.Sprintf("must be a non-negative quantity, got %q", value), reset)
+	}
+}
+
+// Runs the checks that apply to any kubelet configuration. These are
+// not the kubelet's own validation, which would need the whole of
+// k8s.io/kubernetes, but a subset of its rules covering the settings
+// most likely to be got wrong in user data. The README lists them.
+func validateGeneric(c kubelet.KubeletConfiguration, v *configValidator) {
+	v.percent(c.ImageGCHighThresholdPercent, "imageGCHighThresholdPercent", func(c *kubelet.KubeletConfiguration) {
+		c.ImageGCHighThresholdPercent = nil
+	})
+	v.percent(c.ImageGCLowThresholdPercent, "imageGCLowThresholdPercent", func(c *kubelet.KubeletConfiguration) {
+		c.ImageGCLowThresholdPercent = nil
+	})
+	if c.ImageGCHighThresholdPercent != nil && c.ImageGCLowThresholdPercent != nil {
+		v.check(
+			*c.ImageGCLowThresholdPercent < *c.ImageGCHighThresholdPercent,
+			"imageGCLowThresholdPercent",
+			"must be less than imageGCHighThresholdPercent",
+			func(c *kubelet.KubeletConfiguration) {
+				c.ImageGCHighThresholdPercent = nil
+				c.ImageGCLowThresholdPercent = nil
+			},
+		)
+	}
+
+	v.port(int64(c.Port), "port", func(c *kubelet.KubeletConfiguration) { c.Port = 0 })
+	v.port(int64(c.ReadOnlyPort), "readOnlyPort", func(c *kubelet.KubeletConfiguration) { c.ReadOnlyPort = 0 })
+	if c.HealthzPort != nil {
+		v.port(int64(*c.HealthzPort), "healthzPort", func(c *kubelet.KubeletConfiguration) { c.HealthzPort = nil })
+	}
+
+	if c.RegistryPullQPS != nil {
+		v.nonNegative(int64(*c.RegistryPullQPS), "registryPullQPS", func(c *kubelet.KubeletConfiguration) { c.RegistryPullQPS = nil })
+	}
+	v.nonNegative(int64(c.RegistryBurst), "registryBurst", func(c *kubelet.KubeletConfiguration) { c.RegistryBurst = 0 })
+	if c.EventRecordQPS != nil {
+		v.nonNegative(int64(*c.EventRecordQPS), "eventRecordQPS", func(c *kubelet.KubeletConfiguration) { c.EventRecordQPS = nil })
+	}
+	v.nonNegative(int64(c.EventBurst), "eventBurst", func(c *kubelet.KubeletConfiguration) { c.EventBurst = 0 })
+	if c.KubeAPIQPS != nil {
+		v.nonNegative(int64(*c.KubeAPIQPS), "kubeAPIQPS", func(c *kubelet.KubeletConfiguration) { c.KubeAPIQPS = nil })
+	}
+	v.nonNegative(int64(c.KubeAPIBurst), "kubeAPIBurst", func(c *kubelet.KubeletConfiguration) { c.KubeAPIBurst = 0 })
+	v.nonNegative(int64(c.MaxPods), "maxPods", func(c *kubelet.KubeletConfiguration) { c.MaxPods = 0 })
+	v.nonNegative(int64(c.PodsPerCore), "podsPerCore", func(c *kubelet.KubeletConfiguration) { c.PodsPerCore = 0 })
+	v.nonNegative(int64(c.NodeLeaseDurationSeconds), "nodeLeaseDurationSeconds", func(c *kubelet.KubeletConfiguration) {
+		c.NodeLeaseDurationSeconds = 0
+	})
+	v.nonNegative(int64(c.NodeStatusUpdateFrequency.Duration), "nodeStatusUpdateFrequency", func(c *kubelet.KubeletConfiguration) {
+		c.NodeStatusUpdateFrequency.Duration = 0
+	})
+
+	if c.ContainerLogMaxFiles != nil {
+		v.check(*c.ContainerLogMaxFiles > 1, "containerLogMaxFiles", "must be greater than 1", func(c *kubelet.KubeletConfiguration) {
+			c.ContainerLogMaxFiles = nil
+		})
+	}
+	if c.ContainerLogMaxSize != "" {
+		quantity, err := resource.ParseQuantity(c.ContainerLogMaxSize)
+		v.check(err == nil && quantity.Sign() > 0, "containerLogMaxSize", "must be a positive quantity", func(c *kubelet.KubeletConfiguration) {
+			c.ContainerLogMaxSize = ""
+		})
+	}
+
+	v.reserved(c.SystemReserved, "systemReserved", func(c *kubelet.KubeletConfiguration) { c.SystemReserved = nil })
+	v.reserved(c.KubeReserved, "kubeReserved", func(c *kubelet.KubeletConfiguration) { c.KubeReserved = nil })
+
+	v.thresholds(c.EvictionHard, "evictionHard", func(c *kubelet.KubeletConfiguration) { c.EvictionHard = nil })
+	v.thresholds(c.EvictionMinimumReclaim, "evictionMinimumReclaim", func(c *kubelet.KubeletConfiguration) {
+		c.EvictionMinimumReclaim = nil
+	})
+
+	resetSoft := func(c *kubelet.KubeletConfiguration) {
+		c.EvictionSoft = nil
+		c.EvictionSoftGracePeriod = nil
+	}
+	v.thresholds(c.EvictionSoft, "evictionSoft", resetSoft)
+	for signal := range c.EvictionSoft {
+		period, ok := c.EvictionSoftGracePeriod[signal]
+		v.check(ok, "evictionSoftGracePeriod["+signal+"]", "a grace period is required for each soft eviction threshold", resetSoft)
+		if ok {
+			duration, err := time.ParseDuration(period)
+			v.check(err == nil && duration >= 0, "evictionSoftGracePeriod["+signal+"]", fmt.Sprintf("invalid duration %q", period), resetSoft)
+		}
+	}
+
+	resetTaints := func(c *kubelet.KubeletConfiguration) {
+		var valid []v1.Taint
+		for _, taint := range c.RegisterWithTaints {
+			if len(taintProblems(taint)) == 0 {
+				valid = append(valid, taint)
+			}
+		}
+		c.RegisterWithTaints = valid
+	}
+	for i, taint := range c.RegisterWithTaints {
+		for _, msg := range taintProblems(taint) {
+			v.check(false, fmt.Sprintf("registerWithTaints[%d]", i), msg, resetTaints)
+		}
+	}
+}
+
+// Returns a list of the problems with the given taint, if any
+func taintProblems(taint v1.Taint) []string {
+	problems := validation.IsQualifiedName(taint.Key)
+	if taint.Value != "" {
+		problems = append(problems, validation.IsValidLabelValue(taint.Value)...)
+	}
+
+	switch taint.Effect {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+	default:
+		problems = append(problems, fmt.Sprintf("unsupported effect %q", taint.Effect))
+	}
+
+	return problems
+}
+
+// Runs the checks that are specific to running on AWS
+func (p *Provider) validateProvider(c kubelet.KubeletConfiguration, v *configValidator) {
+	resetProviderID := func(c *kubelet.KubeletConfiguration) { c.ProviderID = p.defaultProviderID() }
+	v.check(
+		providerIDPattern.MatchString(c.ProviderID),
+		"providerID",
+		fmt.Sprintf("%q is not in the aws:///<availability-zone>/<instance-id> format", c.ProviderID),
+		resetProviderID,
+	)
+	if instanceId, err := p.imds.GetString("meta-data/instance-id"); err == nil {
+		v.check(
+			strings.HasSuffix(c.ProviderID, "/"+instanceId),
+			"providerID",
+			fmt.Sprintf("%q conflicts with this instance's ID %s", c.ProviderID, instanceId),
+			resetProviderID,
+		)
+	}
+
+	// The service CIDR is only known if it is set in the user data. The
+	// fallback is a guess, which a valid clusterDNS (eg in a custom
+	// service CIDR) should not be reset to match. Link local addresses are
+	// allowed regardless, as used by NodeLocal DNSCache.
+	resetClusterDNS := func(c *kubelet.KubeletConfiguration) { c.ClusterDNS = p.defaultClusterDNS() }
+	explicitCIDR := p.config.ApiServer.ServiceCIDR != ""
+	cidr, cidrErr := p.serviceCIDR()
+	v.check(cidrErr == nil, "serviceCIDR", fmt.Sprintf("invalid service CIDR: %s", cidrErr), resetClusterDNS)
+	for i, dns := range c.ClusterDNS {
+		field := fmt.Sprintf("clusterDNS[%d]", i)
+		ip, err := netip.ParseAddr(dns)
+		if err != nil {
+			v.check(false, field, fmt.Sprintf("%q is not an IP address", dns), resetClusterDNS)
+		} else if explicitCIDR && cidrErr == nil && !ip.IsLinkLocalUnicast() {
+			v.check(cidr.Contains(ip), field, fmt.Sprintf("%s is not within the service CIDR %s", dns, cidr), resetClusterDNS)
+		}
+	}
+
+	if p.config.Node.MaxPods.Set && c.MaxPods != 0 {
+		offset := p.config.Node.MaxPods.Offset
+		v.check(
+			int(c.MaxPods) > offset,
+			"maxPods",
+			fmt.Sprintf("%d leaves no room for pods once the offset of %d host network pods is taken", c.MaxPods, offset),
+			func(c *kubelet.KubeletConfiguration) { c.MaxPods = 0 },
+		)
+	}
+}
+
+// Validates the final kubelet configuration before it is handed over.
+// Depending on the policy in the user data, invalid configurations
+// either stop the bootstrap, or have the offending fields reset to safe
+// defaults.
+func (p *Provider) validateKubeletConfiguration(c kubelet.KubeletConfiguration) kubelet.KubeletConfiguration {
+	switch policy := p.config.Node.KubeletValidationPolicy; policy {
+	case "":
+		p.config.Node.KubeletValidationPolicy = ValidationPolicyDegrade
+	case ValidationPolicyReject, ValidationPolicyDegrade:
+	default:
+		fatalf("Unknown kubeletValidationPolicy %q, expected %s or %s", policy, ValidationPolicyReject, ValidationPolicyDegrade)
+	}
+
+	v := configValidator{}
+	validateGeneric(c, &v)
+	p.validateProvider(c, &v)
+
+	if len(v.problems) == 0 {
+		klog.Info("Kubelet configuration is valid")
+		return c
+	}
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "Kubelet configuration has %d problem(s):", len(v.problems))
+	for _, problem := range v.problems {
+		fmt.Fprintf(&report, "\n  - %s: %s", problem.field, problem.message)
+	}
+
+	if p.config.Node.KubeletValidationPolicy == ValidationPolicyReject {
+		klog.Error(report.String())
+		fatalf("Refusing to write an invalid kubelet configuration (kubeletValidationPolicy is reject)")
+	}
+
+	klog.Warning(report.String())
+	for _, problem := range v.problems {
+		klog.Warningf("Resetting %s to a safe default", problem.field)
+		problem.reset(&c)
+	}
+
+	return c
+}
@@ -0,0 +1,132 @@
+package awsbootstrap
+
+import (
+	"reflect"
+	"testing"
+
+	kubelet "k8s.io/kubelet/config/v1beta1"
+)
+
+// A provider for an instance in a 10.x VPC, where the EKS default
+// service CIDR would be guessed as 172.20.0.0/16
+func validationProvider(t *testing.T, serviceCIDR string) *Provider {
+	return &Provider{
+		imds: fakeImds(t, map[string]string{
+			"meta-data/instance-id":                 "i-0123456789abcdef0",
+			"meta-data/local-ipv4":                  "10.0.0.5",
+			"meta-data/placement/availability-zone": "eu-west-1a",
+		}),
+		config: &MetadataInformation{
+			ApiServer: ApiServer{ServiceCIDR: serviceCIDR},
+			Node:      Node{KubeletValidationPolicy: ValidationPolicyDegrade},
+		},
+	}
+}
+
+func TestValidateClusterDNS(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceCIDR string
+		clusterDNS  []string
+		want        []string
+	}{
+		{
+			name:       "custom service CIDR, guessed",
+			clusterDNS: []string{"10.96.0.10"},
+			want:       []string{"10.96.0.10"},
+		},
+		{
+			name:       "NodeLocal DNSCache, guessed",
+			clusterDNS: []string{"169.254.20.10"},
+			want:       []string{"169.254.20.10"},
+		},
+		{
+			name:        "NodeLocal DNSCache, explicit",
+			serviceCIDR: "10.96.0.0/12",
+			clusterDNS:  []string{"169.254.20.10"},
+			want:        []string{"169.254.20.10"},
+		},
+		{
+			name:        "within the explicit service CIDR",
+			serviceCIDR: "10.96.0.0/12",
+			clusterDNS:  []string{"10.96.0.10"},
+			want:        []string{"10.96.0.10"},
+		},
+		{
+			name:        "outside the explicit service CIDR",
+			serviceCIDR: "10.96.0.0/12",
+			clusterDNS:  []string{"172.20.0.10"},
+			want:        []string{"10.96.0.10"},
+		},
+		{
+			name:       "not an IP",
+			clusterDNS: []string{"kube-dns"},
+			want:       []string{"172.20.0.10"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := validationProvider(t, test.serviceCIDR)
+			config := p.validateKubeletConfiguration(kubelet.KubeletConfiguration{
+				ProviderID: "aws:///eu-west-1a/i-0123456789abcdef0",
+				ClusterDNS: test.clusterDNS,
+			})
+
+			if !reflect.DeepEqual(config.ClusterDNS, test.want) {
+				t.Errorf("ClusterDNS = %v, want %v", config.ClusterDNS, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateProviderID(t *testing.T) {
+	p := validationProvider(t, "")
+
+	for _, providerID := range []string{"", "i-0123456789abcdef0", "aws:///eu-west-1a/i-0fedcba9876543210"} {
+		config := p.validateKubeletConfiguration(kubelet.KubeletConfiguration{ProviderID: providerID})
+		if want := "aws:///eu-west-1a/i-0123456789abcdef0"; config.ProviderID != want {
+			t.Errorf("ProviderID %q was reset to %q, want %q", providerID, config.ProviderID, want)
+		}
+	}
+}
+
+func TestValidateGeneric(t *testing.T) {
+	v := configValidator{}
+	validateGeneric(kubelet.KubeletConfiguration{
+		ImageGCHighThresholdPercent: int32Ptr(50),
+		ImageGCLowThresholdPercent:  int32Ptr(60),
+		Port:                        70000,
+		ContainerLogMaxFiles:        int32Ptr(1),
+		EvictionHard:                map[string]string{"memory.available": "100Mi", "disk.available": "10%"},
+		EvictionSoft:                map[string]string{"memory.available": "200Mi"},
+		SystemReserved:              map[string]string{"cpu": "-1"},
+	}, &v)
+
+	var fields []string
+	for _, problem := range v.problems {
+		fields = append(fields, problem.field)
+	}
+
+	want := []string{
+		"imageGCLowThresholdPercent",
+		"port",
+		"containerLogMaxFiles",
+		"systemReserved[cpu]",
+		"evictionHard[disk.available]",
+		"evictionSoftGracePeriod[memory.available]",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("Problems found with %v, want %v", fields, want)
+	}
+}
+
+func TestValidationPolicyEmpty(t *testing.T) {
+	p := validationProvider(t, "")
+	p.config.Node.KubeletValidationPolicy = ""
+
+	config := p.validateKubeletConfiguration(kubelet.KubeletConfiguration{ProviderID: "i-0123456789abcdef0"})
+	if want := "aws:///eu-west-1a/i-0123456789abcdef0"; config.ProviderID != want {
+		t.Errorf("ProviderID = %q, want it reset to %q as with the degrade policy", config.ProviderID, want)
+	}
+}
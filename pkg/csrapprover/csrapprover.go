@@ -0,0 +1,403 @@
+package csrapprover
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/EmilyShepherd/kios-aws/pkg/awsbootstrap"
+	certificates "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// Pending CSRs are checked again this often, in case they could not be
+// checked the first time (eg if EC2 could not be reached, or the node's
+// identity document annotation was only added after it made its CSR)
+const resyncPeriod = 30 * time.Second
+
+// Looks up EC2 instances. This is an interface so that the approver can
+// be pointed at a fake.
+type InstanceDescriber interface {
+	DescribeInstance(instanceID string) (*awsbootstrap.EC2Instance, error)
+}
+
+// Approves kubelet serving CSRs whose DNS names and IPs all belong to
+// the EC2 instance behind the requesting node. The instance is the one
+// in the Node's providerID, which the node itself set when it
+// registered, so is only trusted outright if IdentityCertificate is
+// unset.
+type Approver struct {
+	Client kubernetes.Interface
+	EC2    InstanceDescriber
+
+	// If set, nodes must have a signed identity document annotation for
+	// the instance in their providerID, which is checked with this (the
+	// AWS public certificate for the region)
+	IdentityCertificate *x509.Certificate
+}
+
+// Parses the CSR's PEM encoded request
+func parseRequest(csr *certificates.CertificateSigningRequest) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("Request is not a PEM encoded certificate request")
+	}
+
+	return x509.ParseCertificateRequest(block.Bytes)
+}
+
+// Checks that the CSR is a serving CSR made by the node it is for, and
+// returns that node's name
+func checkRequester(csr *certificates.CertificateSigningRequest, request *x509.CertificateRequest) (string, error) {
+	nodeName, ok := strings.CutPrefix(csr.Spec.Username, "system:node:")
+	if !ok {
+		return "", fmt.Errorf("Requested by %s, which is not a node", csr.Spec.Username)
+	}
+
+	if request.Subject.CommonName != csr.Spec.Username {
+		return "", fmt.Errorf("Subject %s does not match requester %s", request.Subject.CommonName, csr.Spec.Username)
+	}
+	if len(request.Subject.Organization) != 1 || request.Subject.Organization[0] != "system:nodes" {
+		return "", fmt.Errorf("Subject organisation must be system:nodes")
+	}
+	if len(request.EmailAddresses) != 0 || len(request.URIs) != 0 {
+		return "", fmt.Errorf("Serving certificates cannot have email or URI SANs")
+	}
+
+	for _, usage := range csr.Spec.Usages {
+		switch usage {
+		case certificates.UsageServerAuth, certificates.UsageDigitalSignature, certificates.UsageKeyEncipherment:
+		default:
+			return "", fmt.Errorf("Usage %s is not allowed for a serving certificate", usage)
+		}
+	}
+
+	return nodeName, nil
+}
+
+// Returns the instance ID from an EKS style provider ID
+func instanceID(node *v1.Node) (string, error) {
+	providerID := node.Spec.ProviderID
+	if !strings.HasPrefix(providerID, "aws:///") {
+		return "", fmt.Errorf("Node %s has no AWS provider ID", node.Name)
+	}
+
+	return providerID[strings.LastIndex(providerID, "/")+1:], nil
+}
+
+// Checks the node's signed identity document annotation against the
+// identity certificate, and that it is for the instance and zone in the
+// node's providerID. Nodes can read each other's annotations, so the
+// document is also rejected if another Node claims the same instance.
+func (a *Approver) checkIdentityDocument(ctx context.Context, node *v1.Node) error {
+	document := node.Annotations[awsbootstrap.AnnotationIdentityDocument]
+	encodedSignature := node.Annotations[awsbootstrap.AnnotationIdentitySignature]
+	if document == "" || encodedSignature == "" {
+		return fmt.Errorf("Node %s has no identity document", node.Name)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return fmt.Errorf("Could not decode identity document signature: %s", err)
+	}
+
+	key, ok := a.IdentityCertificate.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("Identity certificate does not have an RSA key")
+	}
+
+	hash := sha256.Sum256([]byte(document))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+		return fmt.Errorf("Identity document signature is invalid: %s", err)
+	}
+
+	var doc awsbootstrap.IdentityDocument
+	if err := json.Unmarshal([]byte(document), &doc); err != nil {
+		return fmt.Errorf("Could not parse identity document: %s", err)
+	}
+
+	providerID := "aws:///" + doc.AvailabilityZone + "/" + doc.InstanceId
+	if doc.InstanceId == "" || providerID != node.Spec.ProviderID {
+		return fmt.Errorf("Identity document is for %s, but node %s is %s", providerID, node.Name, node.Spec.ProviderID)
+	}
+
+	nodes, err := a.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("Could not list nodes: %s", err)
+	}
+	for _, other := range nodes.Items {
+		if other.Name != node.Name && other.Spec.ProviderID == node.Spec.ProviderID {
+			return fmt.Errorf("Node %s also claims to be %s", other.Name, node.Spec.ProviderID)
+		}
+	}
+
+	return nil
+}
+
+// The DNS names an instance may have: its EC2 private and public DNS
+// names, its instance ID, and the IP and resource based names that EC2
+// can give it
+func allowedDNSNames(instance *awsbootstrap.EC2Instance) map[string]bool {
+	names := map[string]bool{instance.InstanceId: true}
+	if instance.PrivateDNSName != "" {
+		names[instance.PrivateDNSName] = true
+
+		_, domain, _ := strings.Cut(instance.PrivateDNSName, ".")
+		if domain != "" {
+			names[instance.InstanceId+"."+domain] = true
+
+			for _, ip := range instance.IPs {
+				if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil && parsed.IsPrivate() {
+					names["ip-"+strings.ReplaceAll(ip, ".", "-")+"."+domain] = true
+				}
+			}
+		}
+	}
+	if instance.PublicDNSName != "" {
+		names[instance.PublicDNSName] = true
+	}
+
+	return names
+}
+
+// Checks that every SAN in the request belongs to the instance
+func checkSANs(request *x509.CertificateRequest, instance *awsbootstrap.EC2Instance) error {
+	if len(request.DNSNames) == 0 && len(request.IPAddresses) == 0 {
+		return fmt.Errorf("Request has no DNS names or IPs")
+	}
+
+	dnsNames := allowedDNSNames(instance)
+	for _, name := range request.DNSNames {
+		if !dnsNames[strings.ToLower(name)] {
+			return fmt.Errorf("DNS name %s does not belong to instance %s", name, instance.InstanceId)
+		}
+	}
+
+	for _, ip := range request.IPAddresses {
+		found := false
+		for _, instanceIP := range instance.IPs {
+			if parsed := net.ParseIP(instanceIP); parsed != nil && parsed.Equal(ip) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("IP %s does not belong to instance %s", ip, instance.InstanceId)
+		}
+	}
+
+	return nil
+}
+
+// Works out whether the CSR should be approved. Returns nil if it
+// should.
+func (a *Approver) check(ctx context.Context, csr *certificates.CertificateSigningRequest) error {
+	request, err := parseRequest(csr)
+	if err != nil {
+		return err
+	}
+
+	nodeName, err := checkRequester(csr, request)
+	if err != nil {
+		return err
+	}
+
+	node, err := a.Client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Could not get node %s: %s", nodeName, err)
+	}
+
+	id, err := instanceID(node)
+	if err != nil {
+		return err
+	}
+
+	if a.IdentityCertificate != nil {
+		if err := a.checkIdentityDocument(ctx, node); err != nil {
+			return err
+		}
+	}
+
+	instance, err := a.EC2.DescribeInstance(id)
+	if err != nil {
+		return fmt.Errorf("Could not describe instance %s: %s", id, err)
+	}
+
+	return checkSANs(request, instance)
+}
+
+// Returns true if the CSR has already been approved or denied
+func isFinished(csr *certificates.CertificateSigningRequest) bool {
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == certificates.CertificateApproved || condition.Type == certificates.CertificateDenied {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks a CSR, and approves it if it matches its instance. CSRs which
+// do not match are left for someone else to deal with.
+func (a *Approver) Handle(ctx context.Context, csr *certificates.CertificateSigningRequest) {
+	if csr.Spec.SignerName != certificates.KubeletServingSignerName || isFinished(csr) {
+		return
+	}
+
+	if err := a.check(ctx, csr); err != nil {
+		klog.Warningf("Not approving CSR %s: %s", csr.Name, err)
+		return
+	}
+
+	csr = csr.DeepCopy()
+	csr.Status.Conditions = append(csr.Status.Conditions, certificates.CertificateSigningRequestCondition{
+		Type:    certificates.CertificateApproved,
+		Status:  v1.ConditionTrue,
+		Reason:  "AutoApproved",
+		Message: "Serving certificate SANs match the node's EC2 instance",
+	})
+
+	_, err := a.Client.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{})
+	if err != nil {
+		klog.Errorf("Could not approve CSR %s: %s", csr.Name, err)
+		return
+	}
+
+	klog.Infof("Approved CSR %s for %s", csr.Name, csr.Spec.Username)
+}
+
+// Watches CSRs until the context is cancelled
+func (a *Approver) Run(ctx context.Context) {
+	factory := informers.NewSharedInformerFactory(a.Client, resyncPeriod)
+	handle := func(obj interface{}) {
+		if csr, ok := obj.(*certificates.CertificateSigningRequest); ok {
+			a.Handle(ctx, csr)
+		}
+	}
+
+	factory.Certificates().V1().CertificateSigningRequests().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    handle,
+		UpdateFunc: func(_, obj interface{}) { handle(obj) },
+	})
+
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+	factory.Shutdown()
+}
+
+// Loads a PEM encoded certificate from disk
+func loadCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %s", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", path)
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// Runs the CSR approver. It uses the in-cluster config unless a
+// kubeconfig is given. AWS credentials come from the environment, IAM
+// Roles for Service Accounts, EKS Pod Identity or IMDS, and are
+// refreshed before they expire.
+func Run() {
+	flags := flag.NewFlagSet("csr-approver", flag.ExitOnError)
+	kubeconfigPath := flags.String("kubeconfig", "", "The kubeconfig to use instead of the in-cluster config")
+	region := flags.String("region", os.Getenv("AWS_REGION"), "The region the cluster's instances are in")
+	fips := flags.Bool("fips", false, "Use FIPS endpoints")
+	ec2Endpoint := flags.String("ec2-endpoint", "", "The EC2 endpoint to use instead of the regional one")
+	identityCertificate := flags.String("identity-certificate", "", "The AWS certificate for the region, to require and check nodes' identity documents with")
+	flags.Parse(os.Args[2:])
+
+	var config *rest.Config
+	var err error
+	if *kubeconfigPath != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfigPath)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		klog.Fatalf("Could not load Kubernetes config: %s", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		klog.Fatalf("Could not create Kubernetes client: %s", err)
+	}
+
+	// IMDS is often not reachable from pods, so is only used if the
+	// region or credentials cannot be found anywhere else
+	var imds *awsbootstrap.ImdsSession
+	imdsSession := func() (*awsbootstrap.ImdsSession, error) {
+		if imds == nil {
+			session, err := awsbootstrap.NewImdsSession(30)
+			if err != nil {
+				return nil, fmt.Errorf("Could not create IMDS Session: %s", err)
+			}
+			imds = session
+		}
+
+		return imds, nil
+	}
+
+	if *region == "" {
+		session, err := imdsSession()
+		if err != nil {
+			klog.Fatal(err)
+		}
+		if *region, err = session.GetString("meta-data/placement/region"); err != nil {
+			klog.Fatalf("Could not determine region: %s", err)
+		}
+	}
+
+	resolver, err := awsbootstrap.NewResolver(*region, *fips)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	ec2, err := awsbootstrap.NewRefreshingAwsClient(resolver, imdsSession)
+	if err != nil {
+		klog.Fatalf("Could not create AWS client: %s", err)
+	}
+	if *ec2Endpoint != "" {
+		ec2.Endpoints = map[string]string{"ec2": *ec2Endpoint}
+	}
+
+	approver := Approver{Client: client, EC2: ec2}
+	if *identityCertificate != "" {
+		if approver.IdentityCertificate, err = loadCertificate(*identityCertificate); err != nil {
+			klog.Fatalf("Could not load identity certificate: %s", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	klog.Info("Watching for kubelet serving CSRs")
+	approver.Run(ctx)
+}
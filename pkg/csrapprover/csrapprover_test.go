@@ -0,0 +1,389 @@
+package csrapprover
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EmilyShepherd/kios-aws/pkg/awsbootstrap"
+	certificates "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testInstanceID = "i-0123456789abcdef0"
+	testNodeName   = "ip-10-0-0-5.eu-west-1.compute.internal"
+)
+
+// A fake EC2 which only knows about the test instance
+func fakeEC2(t *testing.T) *awsbootstrap.AwsClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "DescribeInstances" || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet>`)
+		if r.Form.Get("InstanceId.1") == testInstanceID {
+			fmt.Fprint(w, `<item><instancesSet><item>
+				<instanceId>i-0123456789abcdef0</instanceId>
+				<privateDnsName>ip-10-0-0-5.eu-west-1.compute.internal</privateDnsName>
+				<dnsName>ec2-54-1-2-3.eu-west-1.compute.amazonaws.com</dnsName>
+				<networkInterfaceSet><item>
+					<privateIpAddressesSet>
+						<item><privateIpAddress>10.0.0.5</privateIpAddress><association><publicIp>54.1.2.3</publicIp></association></item>
+						<item><privateIpAddress>10.0.0.6</privateIpAddress></item>
+					</privateIpAddressesSet>
+					<ipv6AddressesSet><item><ipv6Address>2001:db8::5</ipv6Address></item></ipv6AddressesSet>
+				</item></networkInterfaceSet>
+			</item></instancesSet></item>`)
+		}
+		fmt.Fprint(w, `</reservationSet></DescribeInstancesResponse>`)
+	}))
+	t.Cleanup(server.Close)
+
+	resolver, err := awsbootstrap.NewResolver("eu-west-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &awsbootstrap.AwsClient{
+		Region:      "eu-west-1",
+		Resolver:    resolver,
+		Credentials: &awsbootstrap.Credentials{AccessKeyId: "AKIDEXAMPLE", SecretAccessKey: "secret"},
+		HTTPClient:  server.Client(),
+		Endpoints:   map[string]string{"ec2": server.URL},
+	}
+}
+
+// Returns a PEM encoded CSR for the given subject and SANs
+func makeRequest(t *testing.T, subject pkix.Name, dnsNames []string, ips []string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.CertificateRequest{Subject: subject, DNSNames: dnsNames}
+	for _, ip := range ips {
+		template.IPAddresses = append(template.IPAddresses, net.ParseIP(ip))
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestHandle(t *testing.T) {
+	nodeSubject := pkix.Name{CommonName: "system:node:" + testNodeName, Organization: []string{"system:nodes"}}
+	servingUsages := []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageKeyEncipherment, certificates.UsageServerAuth}
+	approved := []certificates.CertificateSigningRequestCondition{{Type: certificates.CertificateApproved, Status: v1.ConditionTrue}}
+	denied := []certificates.CertificateSigningRequestCondition{{Type: certificates.CertificateDenied, Status: v1.ConditionTrue}}
+
+	tests := []struct {
+		name       string
+		username   string
+		signer     string
+		subject    pkix.Name
+		dnsNames   []string
+		ips        []string
+		usages     []certificates.KeyUsage
+		conditions []certificates.CertificateSigningRequestCondition
+		providerID string
+		want       bool
+	}{
+		{
+			name:     "matching SANs",
+			dnsNames: []string{testNodeName, "ec2-54-1-2-3.eu-west-1.compute.amazonaws.com", testInstanceID + ".eu-west-1.compute.internal"},
+			ips:      []string{"10.0.0.5", "10.0.0.6", "54.1.2.3", "2001:db8::5"},
+			want:     true,
+		},
+		{
+			name: "IPs only",
+			ips:  []string{"10.0.0.5"},
+			want: true,
+		},
+		{
+			name:     "foreign IP",
+			dnsNames: []string{testNodeName},
+			ips:      []string{"10.0.0.5", "10.0.0.99"},
+		},
+		{
+			name:     "foreign DNS name",
+			dnsNames: []string{testNodeName, "kubernetes.default.svc"},
+			ips:      []string{"10.0.0.5"},
+		},
+		{
+			name:     "IP name of another instance",
+			dnsNames: []string{"ip-10-0-0-99.eu-west-1.compute.internal"},
+		},
+		{
+			name: "no SANs",
+		},
+		{
+			name:     "not a node",
+			username: "system:serviceaccount:default:attacker",
+			subject:  pkix.Name{CommonName: "system:serviceaccount:default:attacker", Organization: []string{"system:nodes"}},
+			ips:      []string{"10.0.0.5"},
+		},
+		{
+			name:    "subject for another node",
+			subject: pkix.Name{CommonName: "system:node:other", Organization: []string{"system:nodes"}},
+			ips:     []string{"10.0.0.5"},
+		},
+		{
+			name:    "wrong organisation",
+			subject: pkix.Name{CommonName: "system:node:" + testNodeName, Organization: []string{"system:masters"}},
+			ips:     []string{"10.0.0.5"},
+		},
+		{
+			name:   "client auth usage",
+			ips:    []string{"10.0.0.5"},
+			usages: []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageClientAuth},
+		},
+		{
+			name:   "other signer",
+			signer: certificates.KubeAPIServerClientKubeletSignerName,
+			ips:    []string{"10.0.0.5"},
+		},
+		{
+			name:       "already approved",
+			ips:        []string{"10.0.0.5"},
+			conditions: approved,
+			want:       true,
+		},
+		{
+			name:       "already denied",
+			ips:        []string{"10.0.0.5"},
+			conditions: denied,
+		},
+		{
+			name:       "no provider ID",
+			ips:        []string{"10.0.0.5"},
+			providerID: "-",
+		},
+		{
+			name:       "unknown instance",
+			ips:        []string{"10.0.0.5"},
+			providerID: "aws:///eu-west-1a/i-0000000000000000",
+		},
+	}
+
+	ec2 := fakeEC2(t)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.username == "" {
+				test.username = "system:node:" + testNodeName
+			}
+			if test.signer == "" {
+				test.signer = certificates.KubeletServingSignerName
+			}
+			if test.subject.CommonName == "" {
+				test.subject = nodeSubject
+			}
+			if test.usages == nil {
+				test.usages = servingUsages
+			}
+			if test.providerID == "" {
+				test.providerID = "aws:///eu-west-1a/" + testInstanceID
+			} else if test.providerID == "-" {
+				test.providerID = ""
+			}
+
+			csr := &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "csr-1"},
+				Spec: certificates.CertificateSigningRequestSpec{
+					Request:    makeRequest(t, test.subject, test.dnsNames, test.ips),
+					SignerName: test.signer,
+					Usages:     test.usages,
+					Username:   test.username,
+				},
+				Status: certificates.CertificateSigningRequestStatus{Conditions: test.conditions},
+			}
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: testNodeName},
+				Spec:       v1.NodeSpec{ProviderID: test.providerID},
+			}
+
+			client := fake.NewSimpleClientset(csr, node)
+			approver := Approver{Client: client, EC2: ec2}
+			approver.Handle(context.Background(), csr)
+
+			got, err := client.CertificatesV1().CertificateSigningRequests().Get(context.Background(), csr.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			isApproved := false
+			for _, condition := range got.Status.Conditions {
+				if condition.Type == certificates.CertificateApproved {
+					isApproved = true
+				}
+			}
+			if isApproved != test.want {
+				t.Errorf("Approved = %t, want %t", isApproved, test.want)
+			}
+
+			// Finished CSRs must be left alone
+			if len(test.conditions) != 0 && len(got.Status.Conditions) != len(test.conditions) {
+				t.Errorf("Conditions of a finished CSR changed to %v", got.Status.Conditions)
+			}
+		})
+	}
+}
+
+// Returns a self signed RSA certificate standing in for the regional
+// AWS certificate, and a function which signs identity documents with it
+func identityCertificate(t *testing.T) (*x509.Certificate, func(string) string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Amazon Web Services LLC"}}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(document string) string {
+		hash := sha256.Sum256([]byte(document))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return base64.StdEncoding.EncodeToString(signature)
+	}
+
+	return cert, sign
+}
+
+func TestIdentityDocument(t *testing.T) {
+	cert, sign := identityCertificate(t)
+	_, signOther := identityCertificate(t)
+	providerID := "aws:///eu-west-1a/" + testInstanceID
+	document := `{"accountId": "111122223333", "availabilityZone": "eu-west-1a", "instanceId": "` + testInstanceID + `", "region": "eu-west-1"}`
+	otherDocument := `{"accountId": "111122223333", "availabilityZone": "eu-west-1a", "instanceId": "i-0000000000000000", "region": "eu-west-1"}`
+	otherZoneDocument := `{"accountId": "111122223333", "availabilityZone": "eu-west-1b", "instanceId": "` + testInstanceID + `", "region": "eu-west-1"}`
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		otherNode   string
+		want        bool
+	}{
+		{
+			name: "valid",
+			annotations: map[string]string{
+				awsbootstrap.AnnotationIdentityDocument:  document,
+				awsbootstrap.AnnotationIdentitySignature: sign(document),
+			},
+			want: true,
+		},
+		{
+			name: "missing",
+		},
+		{
+			name: "missing signature",
+			annotations: map[string]string{
+				awsbootstrap.AnnotationIdentityDocument: document,
+			},
+		},
+		{
+			name: "signed by another certificate",
+			annotations: map[string]string{
+				awsbootstrap.AnnotationIdentityDocument:  document,
+				awsbootstrap.AnnotationIdentitySignature: signOther(document),
+			},
+		},
+		{
+			name: "signature for another document",
+			annotations: map[string]string{
+				awsbootstrap.AnnotationIdentityDocument:  document,
+				awsbootstrap.AnnotationIdentitySignature: sign(otherDocument),
+			},
+		},
+		{
+			name: "another instance",
+			annotations: map[string]string{
+				awsbootstrap.AnnotationIdentityDocument:  otherDocument,
+				awsbootstrap.AnnotationIdentitySignature: sign(otherDocument),
+			},
+		},
+		{
+			name: "another zone",
+			annotations: map[string]string{
+				awsbootstrap.AnnotationIdentityDocument:  otherZoneDocument,
+				awsbootstrap.AnnotationIdentitySignature: sign(otherZoneDocument),
+			},
+		},
+		{
+			name: "copied from another node",
+			annotations: map[string]string{
+				awsbootstrap.AnnotationIdentityDocument:  document,
+				awsbootstrap.AnnotationIdentitySignature: sign(document),
+			},
+			otherNode: "ip-10-0-0-99.eu-west-1.compute.internal",
+		},
+	}
+
+	ec2 := fakeEC2(t)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			csr := &certificates.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "csr-1"},
+				Spec: certificates.CertificateSigningRequestSpec{
+					Request:    makeRequest(t, pkix.Name{CommonName: "system:node:" + testNodeName, Organization: []string{"system:nodes"}}, nil, []string{"10.0.0.5"}),
+					SignerName: certificates.KubeletServingSignerName,
+					Usages:     []certificates.KeyUsage{certificates.UsageDigitalSignature, certificates.UsageServerAuth},
+					Username:   "system:node:" + testNodeName,
+				},
+			}
+			objects := []runtime.Object{csr, &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: testNodeName, Annotations: test.annotations},
+				Spec:       v1.NodeSpec{ProviderID: providerID},
+			}}
+			if test.otherNode != "" {
+				objects = append(objects, &v1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: test.otherNode, Annotations: test.annotations},
+					Spec:       v1.NodeSpec{ProviderID: providerID},
+				})
+			}
+
+			client := fake.NewSimpleClientset(objects...)
+			approver := Approver{Client: client, EC2: ec2, IdentityCertificate: cert}
+			err := approver.check(context.Background(), csr)
+			if (err == nil) != test.want {
+				t.Errorf("check() = %v, want approved = %t", err, test.want)
+			}
+		})
+	}
+}
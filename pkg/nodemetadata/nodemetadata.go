@@ -0,0 +1,202 @@
+package nodemetadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// The bootstrap writes any node metadata that the kubelet cannot set
+// itself to this file, to be applied once the node has registered.
+const NodeMetadataPath = "/etc/kubernetes/node-metadata.yaml"
+
+// Credentials for a user which is allowed to set labels that the
+// NodeRestriction admission plugin does not let nodes set on
+// themselves. This is optional - without it, restricted labels are only
+// reported.
+const PrivilegedKubeconfigPath = "/etc/kubernetes/node-metadata.conf"
+
+// The kubelet's own kubeconfig. Nodes are allowed to set annotations on
+// themselves, so these are applied using the node's own credentials.
+const KubeletKubeconfigPath = "/etc/kubernetes/kubelet.conf"
+
+const HostnamePath = "/etc/hostname"
+
+// How often to check whether the node has registered yet
+const pollInterval = 5 * time.Second
+
+// Metadata to apply to the Node object after it has registered
+type NodeMetadata struct {
+	// Labels that the kubelet is not allowed to set on itself
+	RestrictedLabels map[string]string `json:"restrictedLabels,omitempty"`
+
+	// The kubelet has no way to register with annotations, so all of
+	// these are applied after registration
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Saves the node metadata to disk, for the helper to pick up
+func (m *NodeMetadata) Save() error {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("Could not marshal node metadata: %s", err)
+	}
+
+	if err := os.WriteFile(NodeMetadataPath, data, 0644); err != nil {
+		return fmt.Errorf("Could not write node metadata: %s", err)
+	}
+
+	klog.Infof("Node metadata written to disk: %s", NodeMetadataPath)
+
+	return nil
+}
+
+// Loads the node metadata saved by the bootstrap
+func Load() (*NodeMetadata, error) {
+	data, err := os.ReadFile(NodeMetadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata NodeMetadata
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", NodeMetadataPath, err)
+	}
+
+	return &metadata, nil
+}
+
+// Creates a Kubernetes client from the given kubeconfig file
+func newClient(path string) (kubernetes.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load kubeconfig %s: %s", path, err)
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+// Returns the name the kubelet will register the node as
+func nodeName() (string, error) {
+	hostname, err := os.ReadFile(HostnamePath)
+	if err != nil {
+		return "", fmt.Errorf("Could not read hostname: %s", err)
+	}
+
+	return strings.ToLower(strings.TrimSpace(string(hostname))), nil
+}
+
+// Waits for the node to register, then applies the given labels or
+// annotations (depending on field) to it with a merge patch
+func patchNode(ctx context.Context, client kubernetes.Interface, name, field string, values map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			field: values,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Could not marshal patch: %s", err)
+	}
+
+	for {
+		_, err := client.CoreV1().Nodes().Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err == nil {
+			klog.Infof("Applied %s to node %s: %v", field, name, values)
+			return nil
+		} else if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("Could not patch node %s: %s", name, err)
+		}
+
+		klog.Infof("Node %s has not registered yet. Waiting", name)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Applies the saved node metadata
+func apply(ctx context.Context) error {
+	metadata, err := Load()
+	if errors.Is(err, os.ErrNotExist) {
+		klog.Info("No node metadata to apply")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	name, err := nodeName()
+	if err != nil {
+		return err
+	}
+
+	var labelsClient kubernetes.Interface
+	var labelsErr error
+	if len(metadata.RestrictedLabels) != 0 {
+		if _, err := os.Stat(PrivilegedKubeconfigPath); err != nil {
+			klog.Warningf(
+				"No privileged kubeconfig at %s, so restricted labels cannot be applied: %v",
+				PrivilegedKubeconfigPath,
+				metadata.RestrictedLabels,
+			)
+		} else {
+			labelsClient, labelsErr = newClient(PrivilegedKubeconfigPath)
+		}
+	}
+
+	var annotationsClient kubernetes.Interface
+	var annotationsErr error
+	if len(metadata.Annotations) != 0 {
+		annotationsClient, annotationsErr = newClient(KubeletKubeconfigPath)
+	}
+
+	return errors.Join(labelsErr, annotationsErr, metadata.apply(ctx, name, labelsClient, annotationsClient))
+}
+
+// Applies the restricted labels and annotations to the node, with their
+// respective clients. A nil client skips that part. The two are
+// independent, as they use different credentials, so one failing does
+// not stop the other.
+func (m *NodeMetadata) apply(ctx context.Context, name string, labelsClient, annotationsClient kubernetes.Interface) error {
+	var labelsErr, annotationsErr error
+
+	if labelsClient != nil && len(m.RestrictedLabels) != 0 {
+		labelsErr = patchNode(ctx, labelsClient, name, "labels", m.RestrictedLabels)
+	}
+
+	if annotationsClient != nil && len(m.Annotations) != 0 {
+		annotationsErr = patchNode(ctx, annotationsClient, name, "annotations", m.Annotations)
+	}
+
+	return errors.Join(labelsErr, annotationsErr)
+}
+
+// Runs the node metadata helper. Once the metadata has been applied, the
+// helper waits to be stopped rather than exiting, as it runs in the
+// static node pod and would otherwise be restarted.
+func Run() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if err := apply(ctx); err != nil {
+		klog.Errorf("Could not apply node metadata: %s", err)
+	}
+
+	<-ctx.Done()
+}
@@ -0,0 +1,108 @@
+package nodemetadata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newNode() *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{
+		Name:   "ip-10-0-0-5.eu-west-1.compute.internal",
+		Labels: map[string]string{"team": "platform"},
+	}}
+}
+
+// A client whose Node patches are all forbidden
+func forbiddenClient() kubernetes.Interface {
+	client := fake.NewSimpleClientset(newNode())
+	client.PrependReactor("patch", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("nodes is forbidden")
+	})
+
+	return client
+}
+
+func getNode(t *testing.T, client kubernetes.Interface) *v1.Node {
+	t.Helper()
+
+	node, err := client.CoreV1().Nodes().Get(context.Background(), newNode().Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Could not get node: %s", err)
+	}
+
+	return node
+}
+
+var metadata = NodeMetadata{
+	RestrictedLabels: map[string]string{"node-role.kubernetes.io/worker": ""},
+	Annotations:      map[string]string{"kios.redcoat.dev/instance-id": "i-0123456789abcdef0"},
+}
+
+func TestApply(t *testing.T) {
+	client := fake.NewSimpleClientset(newNode())
+
+	if err := metadata.apply(context.Background(), newNode().Name, client, client); err != nil {
+		t.Fatalf("apply() returned %v", err)
+	}
+
+	node := getNode(t, client)
+	wantLabels := map[string]string{"team": "platform", "node-role.kubernetes.io/worker": ""}
+	if !reflect.DeepEqual(node.Labels, wantLabels) {
+		t.Errorf("Labels = %v, want %v", node.Labels, wantLabels)
+	}
+	if !reflect.DeepEqual(node.Annotations, metadata.Annotations) {
+		t.Errorf("Annotations = %v, want %v", node.Annotations, metadata.Annotations)
+	}
+}
+
+// Annotations only need the node's own credentials, so should still be
+// applied if the privileged kubeconfig is rejected
+func TestApplyAnnotationsWhenLabelsFail(t *testing.T) {
+	client := fake.NewSimpleClientset(newNode())
+
+	err := metadata.apply(context.Background(), newNode().Name, forbiddenClient(), client)
+	if err == nil {
+		t.Error("apply() did not return the labels error")
+	}
+
+	if node := getNode(t, client); !reflect.DeepEqual(node.Annotations, metadata.Annotations) {
+		t.Errorf("Annotations = %v, want %v", node.Annotations, metadata.Annotations)
+	}
+}
+
+func TestApplyBothFail(t *testing.T) {
+	err := metadata.apply(context.Background(), newNode().Name, forbiddenClient(), forbiddenClient())
+	if err == nil {
+		t.Fatal("apply() returned no error")
+	}
+
+	// Both errors should be reported
+	if joined, ok := err.(interface{ Unwrap() []error }); !ok || len(joined.Unwrap()) != 2 {
+		t.Errorf("apply() returned %v, want both errors", err)
+	}
+}
+
+func TestApplyWithoutLabelsClient(t *testing.T) {
+	client := fake.NewSimpleClientset(newNode())
+
+	if err := metadata.apply(context.Background(), newNode().Name, nil, client); err != nil {
+		t.Fatalf("apply() returned %v", err)
+	}
+
+	node := getNode(t, client)
+	if _, ok := node.Labels["node-role.kubernetes.io/worker"]; ok {
+		t.Error("Restricted label was applied without a labels client")
+	}
+	if !reflect.DeepEqual(node.Annotations, metadata.Annotations) {
+		t.Errorf("Annotations = %v, want %v", node.Annotations, metadata.Annotations)
+	}
+}